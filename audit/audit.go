@@ -0,0 +1,333 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+// Package audit records who changed what to an append-only, hash chained file.
+//
+// Every record carries the SHA-256 of the previous record, and every
+// checkpoint record is signed with an ed25519 key, so that Verify detects
+// edited, removed, reordered and truncated records.
+package audit
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/log"
+	"github.com/spf13/viper"
+)
+
+// Outcomes of an Event.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeDenied  = "denied"
+)
+
+// Entry types.
+const (
+	TypeEvent      = "event"
+	TypeCheckpoint = "checkpoint"
+)
+
+// Event describes a single action.
+type Event struct {
+	Time     time.Time         `json:"time"`
+	Actor    string            `json:"actor"`
+	Action   string            `json:"action"`
+	Resource string            `json:"resource"`
+	Outcome  string            `json:"outcome"`
+	Details  map[string]string `json:"details,omitempty"`
+}
+
+// Entry is one line of the audit file.
+// Hash is the hex SHA-256 of the record encoded with an empty Hash and Signature.
+type Entry struct {
+	Seq       uint64 `json:"seq"`
+	Type      string `json:"type"`
+	Event     *Event `json:"event,omitempty"`
+	Prev      string `json:"prev"`
+	Hash      string `json:"hash"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// genesis is the Prev of the first record.
+var genesis = strings.Repeat("0", sha256.Size*2)
+
+func (r Entry) digest() (string, error) {
+	r.Hash, r.Signature = "", ""
+	b, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Writer appends records to an audit file.
+type Writer struct {
+	mu              sync.Mutex
+	file            *os.File
+	key             ed25519.PrivateKey
+	checkpointEvery int
+	seq             uint64
+	prev            string
+	unsealed        int
+}
+
+// Open opens or creates the audit file at path and continues its hash chain.
+// A checkpoint signed with key is appended every checkpointEvery events and on Close,
+// no checkpoints are written if key is nil.
+func Open(path string, key ed25519.PrivateKey, checkpointEvery int) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+	w := &Writer{key: key, checkpointEvery: checkpointEvery, prev: genesis}
+	if last, err := lastEntry(path); err != nil {
+		return nil, err
+	} else if last != nil {
+		w.seq, w.prev = last.Seq+1, last.Hash
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return nil, err
+	}
+	w.file = f
+	return w, nil
+}
+
+// lastEntry returns the last record of the audit file at path.
+// A final line without newline is left by a crash while appending it: it is terminated if it holds
+// a whole record, otherwise it is cut off, its record was never acknowledged.
+func lastEntry(path string) (*Entry, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		last   *Entry
+		offset int64
+	)
+	rd := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) == 0 {
+				return last, nil
+			}
+			var r Entry
+			if json.Unmarshal(line, &r) == nil {
+				_, err := f.WriteAt([]byte("\n"), offset+int64(len(line)))
+				return &r, err
+			}
+			log.Slogger.Warnf("Audit file %s ends with a partially written record, cutting off its %d bytes", path, len(line))
+			return last, f.Truncate(offset)
+		}
+		if err != nil {
+			return nil, err
+		}
+		var r Entry
+		if err := json.Unmarshal(line, &r); err != nil {
+			return nil, fmt.Errorf("audit file %s is corrupted at byte %d: %v", path, offset, err)
+		}
+		last = &r
+		offset += int64(len(line))
+	}
+}
+
+// Record appends e, filling in its time if unset.
+func (w *Writer) Record(e Event) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.append(Entry{Type: TypeEvent, Event: &e}); err != nil {
+		return err
+	}
+	w.unsealed++
+	if w.checkpointEvery > 0 && w.unsealed >= w.checkpointEvery {
+		return w.checkpoint()
+	}
+	return nil
+}
+
+// Checkpoint appends a signed checkpoint sealing the records written so far.
+func (w *Writer) Checkpoint() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.checkpoint()
+}
+
+// Close seals the file with a final checkpoint and closes it.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var err error
+	if w.unsealed > 0 {
+		err = w.checkpoint()
+	}
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// checkpoint must be called with w.mu held.
+func (w *Writer) checkpoint() error {
+	if w.key == nil {
+		return nil
+	}
+	if err := w.append(Entry{Type: TypeCheckpoint}); err != nil {
+		return err
+	}
+	w.unsealed = 0
+	return nil
+}
+
+// append must be called with w.mu held.
+func (w *Writer) append(r Entry) error {
+	r.Seq, r.Prev = w.seq, w.prev
+	hash, err := r.digest()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	if r.Type == TypeCheckpoint {
+		r.Signature = hex.EncodeToString(ed25519.Sign(w.key, []byte(hash)))
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err := w.file.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.seq, w.prev = w.seq+1, hash
+	return nil
+}
+
+var (
+	// stdMu guards std, Record holds it for reading so Init and Close do not close a file being written.
+	stdMu sync.RWMutex
+	std   *Writer
+)
+
+// Init opens the audit file configured by audit.path, signing checkpoints
+// with the hex encoded ed25519 seed read from audit.signing_key_file.
+// The file opened by a previous Init is sealed and closed first.
+func Init() {
+	stdMu.Lock()
+	defer stdMu.Unlock()
+	if std != nil {
+		if err := std.Close(); err != nil {
+			log.Slogger.Errorf("Close previous audit file failed, error: %v", err)
+		}
+		std = nil
+	}
+	var key ed25519.PrivateKey
+	if path := viper.GetString("audit.signing_key_file"); path != "" {
+		var err error
+		if key, err = ReadPrivateKey(path); err != nil {
+			log.Slogger.Errorf("Read audit signing key %s failed, error: %v", path, err)
+			return
+		}
+	}
+	w, err := Open(viper.GetString("audit.path"), key, viper.GetInt("audit.checkpoint_every"))
+	if err != nil {
+		log.Slogger.Errorf("Open audit file failed, error: %v", err)
+		return
+	}
+	std = w
+}
+
+// Close seals and closes the audit file opened by Init.
+func Close() error {
+	stdMu.Lock()
+	defer stdMu.Unlock()
+	if std == nil {
+		return nil
+	}
+	err := std.Close()
+	std = nil
+	return err
+}
+
+// Record appends e to the audit file opened by Init.
+// Failures are logged, since an action must not fail because auditing it did.
+func Record(e Event) {
+	stdMu.RLock()
+	defer stdMu.RUnlock()
+	if std == nil {
+		log.Slogger.Warnf("Audit is not initialized, event dropped: %s %s %s", e.Actor, e.Action, e.Resource)
+		return
+	}
+	if err := std.Record(e); err != nil {
+		log.Slogger.Errorf("Record audit event failed, error: %v", err)
+	}
+}
+
+// ReadPrivateKey reads a hex encoded ed25519 seed.
+func ReadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	seed, err := readHex(path, ed25519.SeedSize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ReadPublicKey reads a hex encoded ed25519 public key.
+func ReadPublicKey(path string) (ed25519.PublicKey, error) {
+	key, err := readHex(path, ed25519.PublicKeySize)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+func readHex(path string, size int) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != size {
+		return nil, fmt.Errorf("%s holds %d bytes, want %d", path, len(b), size)
+	}
+	return b, nil
+}
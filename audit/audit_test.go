@@ -0,0 +1,196 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package audit
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cauwulixuan/go-kit/log/logtest"
+	"github.com/spf13/viper"
+)
+
+func writeAuditFile(t *testing.T, key ed25519.PrivateKey) []string {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// two sessions, the second continues the chain of the first.
+	for session := 0; session < 2; session++ {
+		w, err := Open(path, key, 2)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		for _, action := range []string{"create", "update", "delete"} {
+			if err := w.Record(Event{Actor: "admin", Action: action, Resource: "jobs/test", Outcome: OutcomeSuccess}); err != nil {
+				t.Fatalf("Record() error = %v", err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.SplitAfter(strings.TrimSuffix(string(content), "\n"), "\n")
+}
+
+func TestVerify(t *testing.T) {
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	otherPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	// 2 sessions of event, event, checkpoint, event, checkpoint.
+	lines := writeAuditFile(t, key)
+	intact, err := Verify(bytes.NewBufferString(strings.Join(lines, "")), pub)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	seen := []VerifyOption{WithMinSeq(intact.Records), WithCheckpoint(intact.LastCheckpointHash)}
+
+	tests := []struct {
+		name         string
+		edit         func(lines []string) []string
+		pub          ed25519.PublicKey
+		opts         []VerifyOption
+		wantErr      bool
+		wantUnsealed int
+	}{
+		{"Intact", func(l []string) []string { return l }, pub, seen, false, 0},
+		{"WrongKey", func(l []string) []string { return l }, otherPub, nil, true, 0},
+		{"Edited", func(l []string) []string {
+			l[3] = strings.Replace(l[3], "delete", "update", 1)
+			return l
+		}, pub, nil, true, 0},
+		{"Removed", func(l []string) []string { return append(l[:1], l[2:]...) }, pub, nil, true, 0},
+		{"Reordered", func(l []string) []string {
+			l[0], l[1] = l[1], l[0]
+			return l
+		}, pub, nil, true, 0},
+		{"TruncatedAfterCheckpoint", func(l []string) []string { return l[:len(l)-1] }, pub, nil, false, 1},
+		{"TruncatedToCheckpoint", func(l []string) []string { return l[:3] }, pub, nil, false, 0},
+		{"TruncatedBeforeMinSeq", func(l []string) []string { return l[:3] }, pub, seen[:1], true, 0},
+		{"TruncatedBeforeCheckpoint", func(l []string) []string { return l[:3] }, pub, seen[1:], true, 0},
+		{"Emptied", func(l []string) []string { return nil }, pub, seen[:1], true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edited := tt.edit(append([]string(nil), lines...))
+			res, err := Verify(bytes.NewBufferString(strings.Join(edited, "")), tt.pub, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && res.Unsealed != tt.wantUnsealed {
+				t.Errorf("Verify() unsealed = %v, want %v", res.Unsealed, tt.wantUnsealed)
+			}
+		})
+	}
+}
+
+func TestOpenPartialLastLine(t *testing.T) {
+	logtest.New(t)
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	lines := writeAuditFile(t, key)
+	tests := []struct {
+		name string
+		tail string
+	}{
+		// the crash cut the record.
+		{"Partial", lines[len(lines)-1][:20]},
+		// the crash came before the newline.
+		{"Unterminated", strings.TrimSuffix(lines[len(lines)-1], "\n")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.log")
+			content := strings.Join(lines[:len(lines)-1], "") + tt.tail
+			if err := os.WriteFile(path, []byte(content), 0640); err != nil {
+				t.Fatal(err)
+			}
+			w, err := Open(path, key, 2)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			if err := w.Record(Event{Actor: "admin", Action: "create", Resource: "jobs/test", Outcome: OutcomeSuccess}); err != nil {
+				t.Fatalf("Record() error = %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := Verify(f, key.Public().(ed25519.PublicKey)); err != nil {
+				t.Errorf("Verify() error = %v after reopening", err)
+			}
+		})
+	}
+}
+
+func TestInit(t *testing.T) {
+	logtest.New(t)
+	defer viper.Reset()
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "audit.key")
+	if err := os.WriteFile(keyFile, []byte(hex.EncodeToString(key.Seed())), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "audit.log")
+	viper.Set("audit.path", path)
+	viper.Set("audit.signing_key_file", keyFile)
+	viper.Set("audit.checkpoint_every", 2)
+	Init()
+
+	// Init again while events are recorded, the previous file is sealed before it is reopened.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				Record(Event{Actor: "admin", Action: "create", Resource: "jobs/test", Outcome: OutcomeSuccess})
+			}
+		}()
+	}
+	Init()
+	wg.Wait()
+	if err := Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	res, err := Verify(f, key.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if res.Events != 40 || res.Unsealed != 0 {
+		t.Errorf("Verify() events = %v, unsealed = %v, want 40 sealed events", res.Events, res.Unsealed)
+	}
+}
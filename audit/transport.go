@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package audit
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Transport records an Event for every mutating request sent through rt,
+// e.g. the Kubernetes API calls of k8s.Client. actor identifies the caller.
+func Transport(actor string, rt http.RoundTripper) http.RoundTripper {
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	return &transport{actor: actor, rt: rt}
+}
+
+type transport struct {
+	actor string
+	rt    http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.rt.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.rt.RoundTrip(req)
+	e := Event{
+		Time:     start,
+		Actor:    t.actor,
+		Action:   req.Method,
+		Resource: req.URL.Path,
+		Outcome:  OutcomeSuccess,
+		Details:  map[string]string{"host": req.URL.Host},
+	}
+	switch {
+	case err != nil:
+		e.Outcome = OutcomeFailure
+		e.Details["error"] = err.Error()
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		e.Outcome = OutcomeDenied
+		e.Details["status"] = strconv.Itoa(resp.StatusCode)
+	case resp.StatusCode >= http.StatusBadRequest:
+		e.Outcome = OutcomeFailure
+		e.Details["status"] = strconv.Itoa(resp.StatusCode)
+	default:
+		e.Details["status"] = strconv.Itoa(resp.StatusCode)
+	}
+	Record(e)
+	return resp, err
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package audit
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxRecordSize bounds a single line of the audit file.
+const maxRecordSize = 1 << 20
+
+// Result summarizes a verified audit file.
+type Result struct {
+	// Events is the number of event records.
+	Events int
+	// Checkpoints is the number of valid checkpoints.
+	Checkpoints int
+	// LastCheckpoint is the Seq of the last checkpoint, -1 if there is none.
+	LastCheckpoint int64
+	// LastCheckpointHash is the Hash of the last checkpoint. Keep it outside of the audit file
+	// and pass it to WithCheckpoint on the next verification to detect truncation.
+	LastCheckpointHash string
+	// Records is the number of records, the Seq the next record gets.
+	Records uint64
+	// Unsealed counts the records after the last checkpoint. They are not covered
+	// by a signature, so removing them cannot be detected; a file closed cleanly has none.
+	Unsealed int
+}
+
+// VerifyError reports the first record breaking the chain.
+type VerifyError struct {
+	Line   int
+	Seq    uint64
+	Reason string
+}
+
+func (e *VerifyError) Error() string {
+	return fmt.Sprintf("audit record %d (line %d): %s", e.Seq, e.Line, e.Reason)
+}
+
+// verifyOptions are what the audit file is known to hold, from an earlier verification.
+type verifyOptions struct {
+	minSeq     uint64
+	checkpoint string
+}
+
+// VerifyOption configures Verify.
+type VerifyOption func(*verifyOptions)
+
+// WithMinSeq fails the verification if the file holds less than n records.
+func WithMinSeq(n uint64) VerifyOption {
+	return func(o *verifyOptions) {
+		o.minSeq = n
+	}
+}
+
+// WithCheckpoint fails the verification if the file does not hold the checkpoint of hash.
+func WithCheckpoint(hash string) VerifyOption {
+	return func(o *verifyOptions) {
+		o.checkpoint = hash
+	}
+}
+
+// Verify checks the hash chain of the records read from r and the signatures
+// of its checkpoints against pub. Signatures are not checked if pub is nil.
+// The chain cannot tell a file cut after a checkpoint from a shorter one,
+// WithMinSeq and WithCheckpoint detect that truncation against what an earlier verification found.
+func Verify(r io.Reader, pub ed25519.PublicKey, opts ...VerifyOption) (Result, error) {
+	var o verifyOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	res := Result{LastCheckpoint: -1}
+	foundCheckpoint := o.checkpoint == ""
+	prev := genesis
+	var seq uint64
+
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), maxRecordSize)
+	line := 0
+	for sc.Scan() {
+		line++
+		fail := func(format string, args ...interface{}) (Result, error) {
+			return res, &VerifyError{Line: line, Seq: seq, Reason: fmt.Sprintf(format, args...)}
+		}
+
+		var rec Entry
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			return fail("malformed record: %v", err)
+		}
+		if rec.Seq != seq {
+			return fail("sequence is %d, records were removed or reordered", rec.Seq)
+		}
+		if rec.Prev != prev {
+			return fail("previous hash mismatch, the previous record was modified or removed")
+		}
+		hash, err := rec.digest()
+		if err != nil {
+			return fail("%v", err)
+		}
+		if rec.Hash != hash {
+			return fail("hash mismatch, the record was modified")
+		}
+
+		switch rec.Type {
+		case TypeEvent:
+			if rec.Event == nil {
+				return fail("event record without event")
+			}
+			res.Events++
+			res.Unsealed++
+		case TypeCheckpoint:
+			if pub != nil {
+				sig, err := hex.DecodeString(rec.Signature)
+				if err != nil || !ed25519.Verify(pub, []byte(rec.Hash), sig) {
+					return fail("invalid checkpoint signature")
+				}
+			}
+			res.Checkpoints++
+			res.LastCheckpoint = int64(rec.Seq)
+			res.LastCheckpointHash = rec.Hash
+			res.Unsealed = 0
+			if rec.Hash == o.checkpoint {
+				foundCheckpoint = true
+			}
+		default:
+			return fail("unknown record type %q", rec.Type)
+		}
+		prev = rec.Hash
+		seq++
+		res.Records = seq
+	}
+	if err := sc.Err(); err != nil {
+		return res, err
+	}
+	if seq < o.minSeq {
+		return res, &VerifyError{Line: line, Seq: seq, Reason: fmt.Sprintf("file ends before record %d, it was truncated", o.minSeq-1)}
+	}
+	if !foundCheckpoint {
+		return res, &VerifyError{Line: line, Seq: seq, Reason: fmt.Sprintf("checkpoint %s not found, the file was truncated or replaced", o.checkpoint)}
+	}
+	return res, nil
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+// Package auth authenticates the requests to other services with the tokens of the auth manager.
+//
+// The service gets its tokens with the client credentials of auth, they are cached until
+// shortly before they expire. The kit's clients send them to the hosts of auth.hosts:
+//
+//	auth.Init()
+//	users, err := http.GetJSON[[]User](ctx, http.ClientFor("account_server"), "/users")
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	kithttp "github.com/cauwulixuan/go-kit/http"
+	"github.com/cauwulixuan/go-kit/log"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/viper"
+)
+
+// Source is the TokenSource set by Init.
+var Source *TokenSource
+
+var (
+	// initMu guards Source and hosts against the requests of the clients Init hooked.
+	initMu sync.RWMutex
+	// hosts are the hosts Init sends the tokens of Source to.
+	hosts []string
+	// hookOnce hooks http.Client and the clients of http.ClientFor on the first Init, the later ones replace Source and hosts.
+	hookOnce sync.Once
+)
+
+// Init sets Source as configured by auth and makes http.Client and the clients of http.ClientFor
+// send its tokens to auth.hosts, or to the host of auth.account_server if none is set.
+// The auth manager is reached with http.ClientFor("auth_manager"), falling back to auth.auth_manager,
+// resolved per fetch so that changes to its config apply. Calling it again replaces the source and the hosts.
+func Init() {
+	secret := viper.GetString("auth.client_secret")
+	if file := viper.GetString("auth.client_secret_file"); file != "" {
+		if b, err := os.ReadFile(file); err != nil {
+			log.Slogger.Errorf("Reading auth client secret failed, using auth.client_secret, error: %v", err)
+		} else {
+			secret = strings.TrimSpace(string(b))
+		}
+	}
+
+	s := &TokenSource{
+		endpoint: func() (*resty.Client, string) {
+			c := kithttp.ClientFor("auth_manager")
+			tokenURL := viper.GetString("auth.token_path")
+			if c.BaseURL == "" {
+				tokenURL = strings.TrimRight(viper.GetString("auth.auth_manager"), "/") + "/" + strings.TrimLeft(tokenURL, "/")
+			}
+			return c, tokenURL
+		},
+		cfg: Config{
+			ClientID:      viper.GetString("auth.client_id"),
+			ClientSecret:  secret,
+			Scope:         viper.GetString("auth.scope"),
+			RefreshBefore: viper.GetDuration("auth.refresh_before"),
+		},
+		now: time.Now,
+	}
+
+	h := viper.GetStringSlice("auth.hosts")
+	if len(h) == 0 {
+		if u, err := url.Parse(viper.GetString("auth.account_server")); err == nil && u.Host != "" {
+			h = []string{u.Host}
+		}
+	}
+	initMu.Lock()
+	Source, hosts = s, h
+	initMu.Unlock()
+
+	hookOnce.Do(func() {
+		apply(kithttp.Client, current)
+		// also runs for the clients built before.
+		kithttp.RegisterClientHook(func(_ string, c *resty.Client) {
+			apply(c, current)
+		})
+	})
+}
+
+// current returns the source and the hosts set by Init.
+func current() (*TokenSource, []string) {
+	initMu.RLock()
+	defer initMu.RUnlock()
+	return Source, hosts
+}
+
+type (
+	// tokenKey holds the token attached to a request.
+	tokenKey struct{}
+	// refreshedKey marks a request retried after a refresh.
+	refreshedKey struct{}
+	// withoutTokenKey marks the requests of the token source itself.
+	withoutTokenKey struct{}
+)
+
+func withoutToken(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withoutTokenKey{}, true)
+}
+
+// Apply makes c send the token of s with its requests to hosts, a host:port or a host name each.
+// A request answered with 401 is retried once after a forced refresh, the retry count of c is raised to 1
+// for it if it is 0. The requests which set their own Authorization are left as they are.
+func (s *TokenSource) Apply(c *resty.Client, hosts ...string) {
+	apply(c, func() (*TokenSource, []string) { return s, hosts })
+}
+
+// apply is Apply with the source and its hosts returned by current for every request, a nil source sends no token.
+func apply(c *resty.Client, current func() (*TokenSource, []string)) {
+	matches := func(c *resty.Client, r *resty.Request, hosts []string) bool {
+		host := kithttp.HostOf(c, r)
+		for _, h := range hosts {
+			if strings.EqualFold(h, host) || strings.EqualFold(h, hostname(host)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	c.OnBeforeRequest(func(c *resty.Client, r *resty.Request) error {
+		ctx := r.Context()
+		s, hosts := current()
+		if s == nil || ctx.Value(withoutTokenKey{}) != nil || !matches(c, r, hosts) {
+			return nil
+		}
+		// the token attached to an earlier attempt is replaced.
+		if attached, _ := ctx.Value(tokenKey{}).(string); attached == "" && (r.Header.Get("Authorization") != "" || r.Token != "") {
+			return nil
+		}
+		token, err := s.Token(ctx)
+		if err != nil {
+			return err
+		}
+		r.SetAuthToken(token.AccessToken)
+		r.SetContext(context.WithValue(ctx, tokenKey{}, token.AccessToken))
+		return nil
+	})
+
+	if c.RetryCount < 1 {
+		c.SetRetryCount(1)
+	}
+	c.AddRetryCondition(func(resp *resty.Response, err error) bool {
+		if err != nil || resp == nil || resp.StatusCode() != http.StatusUnauthorized {
+			return false
+		}
+		r := resp.Request
+		ctx := r.Context()
+		attached, _ := ctx.Value(tokenKey{}).(string)
+		s, _ := current()
+		if s == nil || attached == "" || ctx.Value(refreshedKey{}) != nil {
+			return false
+		}
+		if _, err := s.Refresh(ctx, attached); err != nil {
+			log.Slogger.Errorf("Refreshing the token after a 401 response of %s failed, error: %v", r.URL, err)
+			return false
+		}
+		r.SetContext(context.WithValue(ctx, refreshedKey{}, true))
+		return true
+	})
+}
+
+func hostname(host string) string {
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.Contains(host[i:], "]") {
+		return host[:i]
+	}
+	return host
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	kithttp "github.com/cauwulixuan/go-kit/http"
+	"github.com/cauwulixuan/go-kit/log/logtest"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+)
+
+// authManager is a stand-in for the auth manager, handing out t1, t2, ... to client c1 with secret s1.
+type authManager struct {
+	*httptest.Server
+	issued int32
+	status int
+}
+
+func newAuthManager(t *testing.T) *authManager {
+	m := &authManager{status: http.StatusOK}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.URL.Path != "/oauth/token" || r.Form.Get("grant_type") != "client_credentials" ||
+			r.Form.Get("client_id") != "c1" || r.Form.Get("client_secret") != "s1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if m.status != http.StatusOK {
+			w.WriteHeader(m.status)
+			return
+		}
+		// lets the concurrent callers pile up.
+		time.Sleep(20 * time.Millisecond)
+		n := atomic.AddInt32(&m.issued, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"t%d","token_type":"bearer","expires_in":3600}`, n)
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *authManager) source() *TokenSource {
+	return NewTokenSource(resty.New().SetBaseURL(m.URL), Config{
+		TokenURL: "/oauth/token", ClientID: "c1", ClientSecret: "s1", RefreshBefore: time.Minute,
+	})
+}
+
+func TestTokenSource(t *testing.T) {
+	m := newAuthManager(t)
+	s := m.source()
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if token, err := s.Token(context.Background()); err == nil {
+				tokens[i] = token.AccessToken
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, token := range tokens {
+		if token != "t1" {
+			t.Errorf("token %d = %q, want t1", i, token)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		after time.Duration
+		want  string
+	}{
+		{"Cached", 58 * time.Minute, "t1"},
+		{"RefreshedBeforeExpiry", 59*time.Minute + time.Second, "t2"},
+	}
+	for _, tt := range tests {
+		s.now = func() time.Time { return now.Add(tt.after) }
+		token, err := s.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token.AccessToken != tt.want {
+			t.Errorf("%s: token = %v, want %v", tt.name, token.AccessToken, tt.want)
+		}
+	}
+	if m.issued != 2 {
+		t.Errorf("issued %d tokens, want 2", m.issued)
+	}
+}
+
+func TestTokenRequestLogging(t *testing.T) {
+	logs := logtest.New(t)
+	m := newAuthManager(t)
+	c := resty.New().SetBaseURL(m.URL)
+	(&kithttp.RequestLogger{Level: zapcore.InfoLevel, Bodies: true}).Apply(c)
+	s := NewTokenSource(c, Config{TokenURL: "/oauth/token", ClientID: "c1", ClientSecret: "s1"})
+	if _, err := s.Token(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logs.Filter(zapcore.InfoLevel, "HTTP request")
+	if len(entries) != 1 {
+		t.Fatalf("logged %v, want the token request", logs)
+	}
+	body, _ := entries[0].ContextMap()["request_body"].(string)
+	if !strings.Contains(body, "client_secret="+url.QueryEscape(kithttp.Redacted)) || strings.Contains(body, "s1") {
+		t.Errorf("request_body = %q, want client_secret redacted", body)
+	}
+}
+
+func TestApply(t *testing.T) {
+	logtest.New(t)
+	m := newAuthManager(t)
+	var authorizations []string
+	var revoked atomic.Value
+	revoked.Store("t1")
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization := r.Header.Get("Authorization")
+		authorizations = append(authorizations, authorization)
+		if authorization == "" || revoked.Load() == "*" || authorization == "Bearer "+revoked.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer api.Close()
+	u, _ := url.Parse(api.URL)
+
+	s := m.source()
+	c := resty.New()
+	s.Apply(c, hostname(u.Host))
+
+	// t1 is revoked, so the request is retried once with t2.
+	resp, err := c.R().Get(api.URL)
+	if err != nil || resp.StatusCode() != http.StatusOK {
+		t.Fatalf("Get() = %v, %v, want 200", resp, err)
+	}
+	// all tokens are revoked, the request is retried only once.
+	revoked.Store("*")
+	authorizations = nil
+	if resp, _ := c.R().Get(api.URL); resp.StatusCode() != http.StatusUnauthorized {
+		t.Errorf("Get() status = %v, want 401 after the retry once", resp.StatusCode())
+	}
+	if len(authorizations) != 2 || authorizations[0] != "Bearer t2" || authorizations[1] != "Bearer t3" {
+		t.Errorf("sent %v, want t2 then t3", authorizations)
+	}
+
+	// other hosts and own credentials get no token.
+	revoked.Store("")
+	authorizations = nil
+	other := resty.New()
+	s.Apply(other, "other.example.com")
+	other.R().Get(api.URL)
+	c.R().SetAuthToken("own").Get(api.URL)
+	if len(authorizations) != 2 || authorizations[0] != "" || authorizations[1] != "Bearer own" {
+		t.Errorf("sent %v, want no token and the own one", authorizations)
+	}
+}
+
+func TestApplyTokenError(t *testing.T) {
+	m := newAuthManager(t)
+	m.status = http.StatusServiceUnavailable
+	c := resty.New()
+	m.source().Apply(c, "127.0.0.1")
+
+	_, err := c.R().Get("http://127.0.0.1:1/users")
+	var httpErr *kithttp.Error
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Get() error = %v, want the 503 of the token endpoint", err)
+	}
+}
+
+func TestInit(t *testing.T) {
+	logtest.New(t)
+	defer viper.Reset()
+	prev := Source
+	defer func() { Source = prev }()
+	stale, m := newAuthManager(t), newAuthManager(t)
+	viper.Set("auth.client_id", "c1")
+	viper.Set("auth.client_secret", "s1")
+	viper.Set("auth.client_secret_file", filepath.Join(t.TempDir(), "missing"))
+	viper.Set("auth.token_path", "/oauth/token")
+	viper.Set("auth.hosts", []string{"auth-init.test"})
+	viper.Set("http.clients.auth_manager.base_url", stale.URL)
+	Init()
+
+	// the client of the auth manager changes after Init.
+	viper.Set("http.clients.auth_manager.base_url", m.URL)
+	token, err := Source.Token(context.Background())
+	if err != nil {
+		t.Fatalf("Token() error = %v, want auth.client_secret kept when the secret file is unreadable", err)
+	}
+	if token.AccessToken != "t1" || m.issued != 1 || stale.issued != 0 {
+		t.Errorf("token = %v issued by the new %d and the old %d, want t1 of the new auth manager", token.AccessToken, m.issued, stale.issued)
+	}
+}
+
+func TestInitHooks(t *testing.T) {
+	logtest.New(t)
+	defer viper.Reset()
+	prev := Source
+	defer func() { Source = prev }()
+	var authorizations []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Values("Authorization")...)
+	}))
+	defer api.Close()
+	u, _ := url.Parse(api.URL)
+	viper.Set("http.clients.auth_cached.base_url", api.URL)
+	// built before Init.
+	c := kithttp.ClientFor("auth_cached")
+
+	first, m := newAuthManager(t), newAuthManager(t)
+	viper.Set("auth.client_id", "c1")
+	viper.Set("auth.client_secret", "s1")
+	viper.Set("auth.token_path", "/oauth/token")
+	viper.Set("auth.hosts", []string{u.Host})
+	viper.Set("http.clients.auth_manager.base_url", first.URL)
+	Init()
+	// replaces the source of the first Init instead of adding to it.
+	viper.Set("http.clients.auth_manager.base_url", m.URL)
+	Init()
+
+	if _, err := c.R().Get("/"); err != nil {
+		t.Fatal(err)
+	}
+	if len(authorizations) != 1 || authorizations[0] != "Bearer t1" || first.issued != 0 {
+		t.Errorf("Authorization = %v, want the single token of the last Init", authorizations)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	kithttp "github.com/cauwulixuan/go-kit/http"
+	"github.com/go-resty/resty/v2"
+)
+
+// Token is an access token of the auth manager.
+type Token struct {
+	AccessToken string
+	TokenType   string
+	// Expiry is zero for a token which does not expire.
+	Expiry time.Time
+}
+
+// validAt reports whether t can still be used at now for a request taking up to margin.
+func (t *Token) validAt(now time.Time, margin time.Duration) bool {
+	return t != nil && t.AccessToken != "" && (t.Expiry.IsZero() || now.Add(margin).Before(t.Expiry))
+}
+
+// Config sets how a TokenSource gets its tokens, with the client credentials grant of OAuth 2.0.
+type Config struct {
+	// TokenURL is the token endpoint, relative to the base URL of the client or absolute.
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	// Scope is space separated, "" does not send one.
+	Scope string
+	// RefreshBefore is how long before its expiry a token is refreshed.
+	RefreshBefore time.Duration
+}
+
+// tokenResponse is the successful response of the token endpoint.
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// TokenSource fetches tokens from the auth manager and caches them until shortly before their expiry.
+// Concurrent callers share a single fetch.
+type TokenSource struct {
+	// endpoint returns the client and the URL of the token endpoint, per fetch.
+	endpoint func() (*resty.Client, string)
+	cfg      Config
+	now      func() time.Time
+
+	mu    sync.Mutex
+	token *Token
+	fetch *fetch
+}
+
+// fetch is a request for a token the callers wait for.
+type fetch struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// NewTokenSource returns a TokenSource fetching the tokens of cfg with client.
+func NewTokenSource(client *resty.Client, cfg Config) *TokenSource {
+	return &TokenSource{
+		endpoint: func() (*resty.Client, string) { return client, cfg.TokenURL },
+		cfg:      cfg,
+		now:      time.Now,
+	}
+}
+
+// Token returns the cached token, or fetches a new one if it expires within RefreshBefore.
+func (s *TokenSource) Token(ctx context.Context) (*Token, error) {
+	s.mu.Lock()
+	if s.token.validAt(s.now(), s.cfg.RefreshBefore) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	return s.wait(ctx, s.start())
+}
+
+// Refresh fetches a new token in place of stale, which the server rejected.
+// The cached token is returned if it was refreshed since stale was handed out.
+func (s *TokenSource) Refresh(ctx context.Context, stale string) (*Token, error) {
+	s.mu.Lock()
+	if s.token != nil && s.token.AccessToken != stale && s.token.validAt(s.now(), s.cfg.RefreshBefore) {
+		token := s.token
+		s.mu.Unlock()
+		return token, nil
+	}
+	return s.wait(ctx, s.start())
+}
+
+// start returns the fetch in flight, or starts one. s.mu must be held and is released.
+func (s *TokenSource) start() *fetch {
+	defer s.mu.Unlock()
+	if s.fetch != nil {
+		return s.fetch
+	}
+	f := &fetch{done: make(chan struct{})}
+	s.fetch = f
+	// the values of ctx are not needed and its cancellation must not fail the other callers,
+	// the timeout of the client bounds the fetch.
+	go func() {
+		f.token, f.err = s.request(context.Background())
+		s.mu.Lock()
+		if f.err == nil {
+			s.token = f.token
+		}
+		s.fetch = nil
+		s.mu.Unlock()
+		close(f.done)
+	}()
+	return f
+}
+
+func (s *TokenSource) wait(ctx context.Context, f *fetch) (*Token, error) {
+	select {
+	case <-f.done:
+		return f.token, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// request gets a token from the token endpoint.
+func (s *TokenSource) request(ctx context.Context) (*Token, error) {
+	form := map[string]string{
+		"grant_type":    "client_credentials",
+		"client_id":     s.cfg.ClientID,
+		"client_secret": s.cfg.ClientSecret,
+	}
+	if s.cfg.Scope != "" {
+		form["scope"] = s.cfg.Scope
+	}
+	now := s.now()
+	client, tokenURL := s.endpoint()
+	resp, err := kithttp.Do[tokenResponse](withoutToken(ctx), client.R().SetFormData(form), http.MethodPost, tokenURL)
+	if err != nil {
+		return nil, fmt.Errorf("fetch token: %w", err)
+	}
+	if resp.AccessToken == "" {
+		return nil, fmt.Errorf("fetch token: no access_token in the response of %s", tokenURL)
+	}
+	if resp.TokenType != "" && !strings.EqualFold(resp.TokenType, "bearer") {
+		return nil, fmt.Errorf("fetch token: unsupported token_type %s", resp.TokenType)
+	}
+	token := &Token{AccessToken: resp.AccessToken, TokenType: "Bearer"}
+	if resp.ExpiresIn > 0 {
+		token.Expiry = now.Add(time.Duration(resp.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+// audit-verify checks the hash chain and checkpoint signatures of an audit file.
+//
+//	audit-verify -f logs/audit.log -k audit.pub
+//	audit-verify -f logs/audit.log -k audit.pub --min-seq 1042 --last-checkpoint-hash 9f86d0...
+//	audit-verify --keygen audit
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/cauwulixuan/go-kit/audit"
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	var (
+		path    = pflag.StringP("file", "f", "logs/audit.log", "path to the audit file")
+		pubPath = pflag.StringP("key", "k", "", "path to the hex encoded ed25519 public key, signatures are not checked if empty")
+		strict  = pflag.Bool("strict", false, "fail if records follow the last checkpoint or the file is empty")
+		minSeq  = pflag.Uint64("min-seq", 0, "fail if the file holds fewer records, e.g. the records of the previous verification")
+		lastCP  = pflag.String("last-checkpoint-hash", "", "fail if the file does not hold this checkpoint, e.g. the last one of the previous verification")
+		keyGen  = pflag.String("keygen", "", "write a new signing key to <prefix>.key and its public key to <prefix>.pub, then exit")
+	)
+	pflag.Parse()
+
+	if *keyGen != "" {
+		if err := generateKey(*keyGen); err != nil {
+			fmt.Fprintf(os.Stderr, "Generate key failed, error: %v\n", err)
+			os.Exit(2)
+		}
+		return
+	}
+
+	var pub ed25519.PublicKey
+	if *pubPath != "" {
+		var err error
+		if pub, err = audit.ReadPublicKey(*pubPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Read public key failed, error: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	f, err := os.Open(*path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Open audit file failed, error: %v\n", err)
+		os.Exit(2)
+	}
+	defer f.Close()
+
+	res, err := audit.Verify(f, pub, audit.WithMinSeq(*minSeq), audit.WithCheckpoint(*lastCP))
+	fmt.Printf("records: %d, events: %d, checkpoints: %d, last checkpoint: %d %s, unsealed records: %d\n",
+		res.Records, res.Events, res.Checkpoints, res.LastCheckpoint, res.LastCheckpointHash, res.Unsealed)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "TAMPERED: %v\n", err)
+		os.Exit(1)
+	}
+	if *minSeq == 0 && *lastCP == "" {
+		fmt.Fprintln(os.Stderr, "WARNING: truncation after a checkpoint is not detected without --min-seq or --last-checkpoint-hash, keep the records and the last checkpoint hash above for the next run.")
+	}
+	if res.Records == 0 {
+		fmt.Fprintln(os.Stderr, "WARNING: the audit file is empty.")
+		if *strict {
+			os.Exit(1)
+		}
+	}
+	if res.Unsealed > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: %d records after the last checkpoint, the file may be truncated or still open.\n", res.Unsealed)
+		if *strict {
+			os.Exit(1)
+		}
+	}
+	fmt.Println("OK")
+}
+
+func generateKey(prefix string) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(prefix+".key", []byte(hex.EncodeToString(priv.Seed())+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(prefix+".pub", []byte(hex.EncodeToString(pub)+"\n"), 0644)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// filter selects entries, its zero value selects all of them.
+type filter struct {
+	minLevel *zapcore.Level
+	since    time.Time
+	until    time.Time
+	logger   string
+	caller   string
+	conds    []cond
+}
+
+// cond compares a field to value, or matches it against re if set.
+type cond struct {
+	key   string
+	value string
+	re    *regexp.Regexp
+}
+
+// argTimeLayouts are the accepted formats of --since and --until besides durations.
+var argTimeLayouts = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02", time.RFC3339}
+
+func newFilter(level, since, until, logger, caller string, where []string, now time.Time) (*filter, error) {
+	f := &filter{logger: logger, caller: caller}
+	if level != "" {
+		l, err := zapcore.ParseLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		f.minLevel = &l
+	}
+	var err error
+	if f.since, err = parseTimeArg(since, now); err != nil {
+		return nil, err
+	}
+	if f.until, err = parseTimeArg(until, now); err != nil {
+		return nil, err
+	}
+	for _, w := range where {
+		c, err := parseCond(w)
+		if err != nil {
+			return nil, err
+		}
+		f.conds = append(f.conds, c)
+	}
+	return f, nil
+}
+
+// parseTimeArg parses a time, or a duration before now.
+func parseTimeArg(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range argTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
+
+// parseCond parses key=value or key~regex, whichever separator comes first.
+func parseCond(s string) (cond, error) {
+	i := strings.IndexAny(s, "=~")
+	if i <= 0 {
+		return cond{}, fmt.Errorf("invalid condition %q, want key=value or key~regex", s)
+	}
+	c := cond{key: s[:i], value: s[i+1:]}
+	if s[i] == '~' {
+		re, err := regexp.Compile(c.value)
+		if err != nil {
+			return cond{}, err
+		}
+		c.re = re
+	}
+	return c, nil
+}
+
+func (f *filter) match(e *entry) bool {
+	if f.minLevel != nil && e.level < *f.minLevel {
+		return false
+	}
+	if !f.since.IsZero() && e.time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && !e.time.Before(f.until) {
+		return false
+	}
+	if f.logger != "" && e.builtin("logger") != f.logger {
+		return false
+	}
+	if f.caller != "" && !strings.HasPrefix(e.builtin("caller"), f.caller) {
+		return false
+	}
+	for _, c := range f.conds {
+		v, ok := lookup(e.fields, c.key)
+		if !ok {
+			return false
+		}
+		if c.re != nil && !c.re.MatchString(stringOf(v)) || c.re == nil && stringOf(v) != c.value {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the field at key, dots in key descend into nested objects
+// unless a field is named with the dots.
+func lookup(fields map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := fields[key]; ok {
+		return v, true
+	}
+	for i := strings.IndexByte(key, '.'); i > 0; i = nextDot(key, i) {
+		nested, ok := fields[key[:i]].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if v, ok := lookup(nested, key[i+1:]); ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+func nextDot(key string, i int) int {
+	j := strings.IndexByte(key[i+1:], '.')
+	if j < 0 {
+		return -1
+	}
+	return i + 1 + j
+}
+
+// stringOf formats a decoded JSON value, objects and arrays as JSON.
+func stringOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
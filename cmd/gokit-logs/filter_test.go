@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFilter(t *testing.T) {
+	line := `{"level":"WARN","time":"2026-10-18 08:30:00.0000000","logger":"http","caller":"http/client.go:42","msg":"request timed out","status":504,"errorDetails":{"code":"Unavailable"}}`
+	e, ok := parseEntry([]byte(line), defaultLayout)
+	if !ok {
+		t.Fatalf("parseEntry() failed")
+	}
+	now := time.Date(2026, 10, 18, 9, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name   string
+		level  string
+		since  string
+		until  string
+		logger string
+		caller string
+		where  []string
+		want   bool
+	}{
+		{"All", "", "", "", "", "", nil, true},
+		{"Level", "warn", "", "", "", "", nil, true},
+		{"LevelAbove", "error", "", "", "", "", nil, false},
+		{"Since", "", "2026-10-18 08:00", "", "", "", nil, true},
+		{"SinceDuration", "", "15m", "", "", "", nil, false},
+		{"Until", "", "", "2026-10-18 08:30:00", "", "", nil, false},
+		{"Logger", "", "", "", "http", "", nil, true},
+		{"OtherLogger", "", "", "", "k8s", "", nil, false},
+		{"Caller", "", "", "", "", "http/", nil, true},
+		{"Equal", "", "", "", "", "", []string{"status=504"}, true},
+		{"NotEqual", "", "", "", "", "", []string{"status=500"}, false},
+		{"Regex", "", "", "", "", "", []string{"msg~time(d)? ?out"}, true},
+		{"Nested", "", "", "", "", "", []string{"errorDetails.code=Unavailable"}, true},
+		{"Missing", "", "", "", "", "", []string{"tenant=a"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newFilter(tt.level, tt.since, tt.until, tt.logger, tt.caller, tt.where, now)
+			if err != nil {
+				t.Fatalf("newFilter() error = %v", err)
+			}
+			if got := f.match(e); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
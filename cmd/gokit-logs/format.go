@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type printer interface {
+	print(e *entry)
+	flush()
+}
+
+func newPrinter(w io.Writer, output string, color bool) (printer, error) {
+	switch output {
+	case "console":
+		return &consolePrinter{w: bufio.NewWriter(w), color: color}, nil
+	case "json":
+		return &jsonPrinter{w: bufio.NewWriter(w)}, nil
+	case "table":
+		return &tablePrinter{w: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)}, nil
+	}
+	return nil, fmt.Errorf("unknown output %q, want console, json or table", output)
+}
+
+// jsonPrinter writes the entries as they were read.
+type jsonPrinter struct {
+	w *bufio.Writer
+}
+
+func (p *jsonPrinter) print(e *entry) {
+	p.w.Write(e.raw)
+	p.w.WriteByte('\n')
+}
+
+func (p *jsonPrinter) flush() {
+	p.w.Flush()
+}
+
+// consolePrinter writes an entry per line like the kit's console encoder, followed by its stack trace.
+type consolePrinter struct {
+	w     *bufio.Writer
+	color bool
+}
+
+var levelColors = map[zapcore.Level]string{
+	zapcore.DebugLevel: "\x1b[35m",
+	zapcore.InfoLevel:  "\x1b[34m",
+	zapcore.WarnLevel:  "\x1b[33m",
+}
+
+func (p *consolePrinter) print(e *entry) {
+	level := strings.ToUpper(e.level.String())
+	if p.color {
+		c, ok := levelColors[e.level]
+		if !ok {
+			c = "\x1b[31m"
+		}
+		level = c + level + "\x1b[0m"
+	}
+	columns := []string{e.timeString(), level}
+	for _, name := range []string{"logger", "caller"} {
+		if v := e.builtin(name); v != "" {
+			columns = append(columns, v)
+		}
+	}
+	columns = append(columns, e.builtin("message"))
+	if fields := fieldsOf(e); fields != "" {
+		columns = append(columns, fields)
+	}
+	p.w.WriteString(strings.Join(columns, "\t"))
+	p.w.WriteByte('\n')
+	if stack := e.builtin("stacktrace"); stack != "" {
+		p.w.WriteString(stack)
+		p.w.WriteByte('\n')
+	}
+}
+
+func (p *consolePrinter) flush() {
+	p.w.Flush()
+}
+
+// tablePrinter aligns the entries in columns, multi-line values are folded.
+type tablePrinter struct {
+	w      *tabwriter.Writer
+	header bool
+}
+
+func (p *tablePrinter) print(e *entry) {
+	if !p.header {
+		fmt.Fprintln(p.w, "TIME\tLEVEL\tLOGGER\tCALLER\tMESSAGE\tFIELDS")
+		p.header = true
+	}
+	fmt.Fprintf(p.w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+		e.timeString(),
+		strings.ToUpper(e.level.String()),
+		fold(e.builtin("logger")),
+		fold(e.builtin("caller")),
+		fold(e.builtin("message")),
+		fold(fieldsOf(e)))
+}
+
+func (p *tablePrinter) flush() {
+	p.w.Flush()
+}
+
+var folder = strings.NewReplacer("\t", " ", "\n", " ", "\r", "")
+
+func fold(s string) string {
+	return folder.Replace(s)
+}
+
+// fieldsOf formats the non builtin fields of e as key=value in their original order,
+// the builtin ones get their own columns.
+func fieldsOf(e *entry) string {
+	var b strings.Builder
+	for _, key := range e.keys {
+		if e.layout.builtin[key] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		v := stringOf(e.fields[key])
+		if strings.ContainsAny(v, " \t\n\"") {
+			v = fmt.Sprintf("%q", v)
+		}
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(v)
+	}
+	return b.String()
+}
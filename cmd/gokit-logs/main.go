@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+// gokit-logs reads and follows the JSON log files written by the kit's logger.
+// Rotated backups, gzipped or not, are read first in rotation order and the entries
+// of several files are merged by time.
+//
+//	gokit-logs                                    # logs/info.log and logs/warn.log with their backups
+//	gokit-logs -l warn --since 1h -o table
+//	gokit-logs -F --caller http/ -w 'status=500' -w 'msg~time(d)?out' logs/warn.log
+//	gokit-logs --keys time=ts,message=message --time-format epoch_millis   # as set by log.keys and log.time_format
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+func main() {
+	var (
+		follow   = pflag.BoolP("follow", "F", false, "keep reading new entries, following rotation")
+		rotated  = pflag.Bool("rotated", true, "also read the rotated backups of the files")
+		level    = pflag.StringP("level", "l", "", "only entries at or above level")
+		since    = pflag.String("since", "", "only entries at or after a time, e.g. '2026-10-18 08:00:00', 2026-10-18 or 1h ago as 1h")
+		until    = pflag.String("until", "", "only entries before a time, same formats as --since")
+		logger   = pflag.String("logger", "", "only entries of the logger name")
+		caller   = pflag.String("caller", "", "only entries whose caller starts with the prefix, e.g. http/client.go")
+		where    = pflag.StringArrayP("where", "w", nil, "only entries whose field equals (key=value) or matches (key~regex), dotted keys reach nested fields")
+		output   = pflag.StringP("output", "o", "console", "output format: console, json or table")
+		noColor  = pflag.Bool("no-color", false, "do not color levels in console output")
+		keys     = pflag.StringToString("keys", nil, "keys of the builtin fields as set by log.keys, e.g. time=ts,message=message")
+		timeFmt  = pflag.String("time-format", "", "time format as set by log.time_format, numeric times are guessed from their magnitude if it is not an epoch one")
+		interval = pflag.Duration("interval", 500*time.Millisecond, "poll interval of --follow")
+	)
+	pflag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gokit-logs [flags] [file...]\n\nFiles default to logs/info.log and logs/warn.log.\n\n")
+		pflag.PrintDefaults()
+	}
+	pflag.Parse()
+
+	f, err := newFilter(*level, *since, *until, *logger, *caller, *where, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid filter, error: %v\n", err)
+		os.Exit(2)
+	}
+	l, err := newLayout(*keys, *timeFmt)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid keys, error: %v\n", err)
+		os.Exit(2)
+	}
+	p, err := newPrinter(os.Stdout, *output, colorEnabled(*noColor))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid output, error: %v\n", err)
+		os.Exit(2)
+	}
+
+	files := pflag.Args()
+	if len(files) == 0 {
+		files = []string{"logs/info.log", "logs/warn.log"}
+	}
+
+	var sources []*source
+	for _, file := range files {
+		var paths []string
+		if *rotated {
+			backups, err := backupsOf(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "List backups of %s failed, error: %v\n", file, err)
+				os.Exit(2)
+			}
+			paths = append(paths, backups...)
+		}
+		if _, err := os.Stat(file); err == nil || *follow {
+			paths = append(paths, file)
+		}
+		if len(paths) == 0 {
+			fmt.Fprintf(os.Stderr, "No log files found for %s\n", file)
+			continue
+		}
+		sources = append(sources, newSource(paths, l))
+	}
+
+	if err := merge(sources, f, p); err != nil {
+		fmt.Fprintf(os.Stderr, "Read logs failed, error: %v\n", err)
+		os.Exit(1)
+	}
+	if *follow {
+		if err := followAll(sources, f, p, *interval); err != nil {
+			fmt.Fprintf(os.Stderr, "Follow logs failed, error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// colorEnabled reports whether stdout is a terminal and colors are not disabled.
+func colorEnabled(noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
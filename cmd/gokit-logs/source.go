@@ -0,0 +1,438 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// timeLayouts are tried in order to parse the time of an entry.
+var timeLayouts = []string{"2006-01-02 15:04:05.0000000", time.RFC3339Nano, "2006-01-02 15:04:05"}
+
+// defaultKeys are the keys of the builtin fields by their names in log.keys.
+var defaultKeys = map[string]string{
+	"time": "time", "level": "level", "message": "msg", "logger": "logger", "caller": "caller", "stacktrace": "stacktrace",
+}
+
+// layout is how the kit's logger wrote the entries, as set by its log.keys and log.time_format.
+type layout struct {
+	// keys are the keys of the builtin fields by their names in log.keys.
+	keys map[string]string
+	// builtin is the set of the keys of the builtin fields.
+	builtin map[string]bool
+	// timeFormat is log.time_format, numeric times are read in the unit of its epoch formats
+	// and guessed from their magnitude if it is not one.
+	timeFormat string
+}
+
+// newLayout returns the layout of keys overriding defaultKeys and timeFormat, as set by log.keys and log.time_format.
+func newLayout(keys map[string]string, timeFormat string) (*layout, error) {
+	l := &layout{keys: make(map[string]string), builtin: make(map[string]bool), timeFormat: timeFormat}
+	for name, key := range defaultKeys {
+		l.keys[name] = key
+	}
+	for name, key := range keys {
+		if _, ok := defaultKeys[name]; !ok {
+			return nil, fmt.Errorf("unknown key %q, want time, level, message, logger, caller or stacktrace", name)
+		}
+		l.keys[name] = key
+	}
+	for _, key := range l.keys {
+		l.builtin[key] = true
+	}
+	return l, nil
+}
+
+// defaultLayout is the layout of the kit's default settings.
+var defaultLayout, _ = newLayout(nil, "")
+
+// escapes matches the ANSI colors of the capital_color and lowercase_color level formats.
+var escapes = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+
+// parseTime returns the time of the time field v.
+func (l *layout) parseTime(v interface{}) time.Time {
+	switch v := v.(type) {
+	case string:
+		layouts := timeLayouts
+		switch l.timeFormat {
+		case "", "rfc3339", "rfc3339nano", "iso8601", "epoch", "epoch_millis", "epoch_nanos":
+			layouts = append(layouts, "2006-01-02T15:04:05.000Z0700")
+		default:
+			layouts = append([]string{l.timeFormat}, layouts...)
+		}
+		for _, layout := range layouts {
+			if parsed, err := time.ParseInLocation(layout, v, time.Local); err == nil {
+				return parsed
+			}
+		}
+	case json.Number:
+		n, err := v.Float64()
+		if err != nil {
+			return time.Time{}
+		}
+		unit := time.Second
+		switch {
+		case l.timeFormat == "epoch_nanos", l.timeFormat != "epoch" && l.timeFormat != "epoch_millis" && n >= 1e17:
+			unit = time.Nanosecond
+		case l.timeFormat == "epoch_millis", l.timeFormat != "epoch" && n >= 1e11:
+			unit = time.Millisecond
+		}
+		if unit == time.Nanosecond {
+			// float64 loses the last digits of nanoseconds.
+			if ns, err := v.Int64(); err == nil {
+				return time.Unix(0, ns)
+			}
+		}
+		return time.Unix(0, int64(n*float64(unit)))
+	}
+	return time.Time{}
+}
+
+// entry is a decoded log line, keys keeps the order of its fields.
+type entry struct {
+	raw    []byte
+	keys   []string
+	fields map[string]interface{}
+	layout *layout
+	time   time.Time
+	level  zapcore.Level
+}
+
+// builtin returns the builtin field name, named as in log.keys.
+func (e *entry) builtin(name string) string {
+	return stringOf(e.fields[e.layout.keys[name]])
+}
+
+// timeString returns the time of e as written, numeric times formatted like the kit's default.
+func (e *entry) timeString() string {
+	if _, ok := e.fields[e.layout.keys["time"]].(json.Number); ok && !e.time.IsZero() {
+		return e.time.Format(timeLayouts[0])
+	}
+	return e.builtin("time")
+}
+
+// parseEntry decodes a JSON log line written with layout l, ok is false if it is not one.
+func parseEntry(line []byte, l *layout) (*entry, bool) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, false
+	}
+	e := &entry{raw: line, fields: make(map[string]interface{}), layout: l}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, _ := tok.(string)
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return nil, false
+		}
+		if _, ok := e.fields[key]; !ok {
+			e.keys = append(e.keys, key)
+		}
+		e.fields[key] = v
+	}
+
+	e.level, _ = zapcore.ParseLevel(escapes.ReplaceAllString(e.builtin("level"), ""))
+	e.time = l.parseTime(e.fields[l.keys["time"]])
+	return e, true
+}
+
+// backupsOf lists the rotated backups of path, oldest first.
+// Both lumberjack and the kit's RotateWriter name them {name}-{time}{ext}, optionally gzipped,
+// and keep their modification time when compressing, so they are ordered by it.
+func backupsOf(path string) ([]string, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	ext := filepath.Ext(base)
+	matcher := regexp.MustCompile("^" + regexp.QuoteMeta(strings.TrimSuffix(base, ext)) + "-.+" + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	type backup struct {
+		path    string
+		modTime time.Time
+	}
+	var backups []backup
+	for _, e := range entries {
+		if e.IsDir() || !matcher.MatchString(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, e.Name()), modTime: info.ModTime()})
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		if !backups[i].modTime.Equal(backups[j].modTime) {
+			return backups[i].modTime.Before(backups[j].modTime)
+		}
+		return lessBackupName(backups[i].path, backups[j].path)
+	})
+
+	paths := make([]string, 0, len(backups))
+	for _, b := range backups {
+		paths = append(paths, b.path)
+	}
+	return paths, nil
+}
+
+// collisionIndex matches the .N suffix RotateWriter adds to backups rotated within the same time.
+var collisionIndex = regexp.MustCompile(`\.(\d+)\.[^.]+(\.gz)?$`)
+
+func lessBackupName(a, b string) bool {
+	indexOf := func(name string) (string, int) {
+		m := collisionIndex.FindStringSubmatchIndex(name)
+		if m == nil {
+			return name, 0
+		}
+		i, _ := strconv.Atoi(name[m[2]:m[3]])
+		return name[:m[2]-1] + name[m[3]:], i
+	}
+	aBase, aIndex := indexOf(a)
+	bBase, bIndex := indexOf(b)
+	if aBase != bBase {
+		return aBase < bBase
+	}
+	return aIndex < bIndex
+}
+
+// source reads the entries of a file and its backups in order, the last file can be followed.
+type source struct {
+	paths  []string
+	layout *layout
+	index  int
+
+	file    *os.File
+	reader  *bufio.Reader
+	closer  io.Closer
+	offset  int64
+	partial []byte
+	head    *entry
+}
+
+func newSource(paths []string, l *layout) *source {
+	return &source{paths: paths, layout: l, index: -1}
+}
+
+// last reports whether the current file is the followed one.
+func (s *source) last() bool {
+	return s.index == len(s.paths)-1
+}
+
+func (s *source) open(index int) error {
+	s.close()
+	s.index = index
+	f, err := os.Open(s.paths[index])
+	if err != nil {
+		if os.IsNotExist(err) && s.last() {
+			// followed file which is not created yet.
+			return nil
+		}
+		return err
+	}
+	s.file, s.offset = f, 0
+	var r io.Reader = f
+	if strings.HasSuffix(f.Name(), ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			s.file = nil
+			return err
+		}
+		r, s.closer = zr, zr
+	}
+	s.reader = bufio.NewReader(r)
+	return nil
+}
+
+func (s *source) close() {
+	if s.closer != nil {
+		s.closer.Close()
+		s.closer = nil
+	}
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	s.reader, s.partial = nil, nil
+}
+
+// nextLine returns the next complete line, io.EOF once the last file has no more.
+// An unterminated line at the end of the last file is kept until it is completed.
+func (s *source) nextLine() ([]byte, error) {
+	for {
+		if s.reader == nil {
+			if s.index >= len(s.paths)-1 {
+				return nil, io.EOF
+			}
+			if err := s.open(s.index + 1); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		chunk, err := s.reader.ReadBytes('\n')
+		s.offset += int64(len(chunk))
+		s.partial = append(s.partial, chunk...)
+		if err == nil {
+			line := s.partial
+			s.partial = nil
+			return bytes.TrimRight(line, "\r\n"), nil
+		}
+		if err != io.EOF {
+			return nil, err
+		}
+		if s.last() {
+			return nil, io.EOF
+		}
+		line := s.partial
+		s.close()
+		if len(line) > 0 {
+			return line, nil
+		}
+	}
+}
+
+// next returns the next entry, nil once the source has no more for now. Lines which are not JSON are skipped.
+func (s *source) next() (*entry, error) {
+	if s.head != nil {
+		e := s.head
+		s.head = nil
+		return e, nil
+	}
+	for {
+		line, err := s.nextLine()
+		if err == io.EOF {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := parseEntry(line, s.layout); ok {
+			return e, nil
+		}
+	}
+}
+
+// peek returns the next entry without consuming it.
+func (s *source) peek() (*entry, error) {
+	if s.head == nil {
+		e, err := s.next()
+		if err != nil {
+			return nil, err
+		}
+		s.head = e
+	}
+	return s.head, nil
+}
+
+// reopenIfRotated drains and reopens the followed file once it was rotated away or truncated.
+func (s *source) reopenIfRotated() error {
+	path := s.paths[len(s.paths)-1]
+	if strings.HasSuffix(path, ".gz") {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		// rotated away, the new file is not created yet.
+		return nil
+	}
+	if s.file != nil {
+		current, err := s.file.Stat()
+		if err == nil && os.SameFile(info, current) && info.Size() >= s.offset {
+			return nil
+		}
+	}
+	return s.open(len(s.paths) - 1)
+}
+
+// merge prints the entries of all sources ordered by time, each source is ordered already.
+func merge(sources []*source, f *filter, p printer) error {
+	defer p.flush()
+	for {
+		var first *source
+		var firstEntry *entry
+		for _, s := range sources {
+			e, err := s.peek()
+			if err != nil {
+				return err
+			}
+			if e != nil && (firstEntry == nil || e.time.Before(firstEntry.time)) {
+				first, firstEntry = s, e
+			}
+		}
+		if first == nil {
+			return nil
+		}
+		first.head = nil
+		if f.match(firstEntry) {
+			p.print(firstEntry)
+		}
+	}
+}
+
+// followAll prints the entries appended to the last file of each source until the process is stopped.
+func followAll(sources []*source, f *filter, p printer, interval time.Duration) error {
+	for {
+		time.Sleep(interval)
+		for _, s := range sources {
+			for {
+				e, err := s.next()
+				if err != nil {
+					return err
+				}
+				if e == nil {
+					break
+				}
+				if f.match(e) {
+					p.print(e)
+				}
+			}
+			// entries written to the old file before its rotation are read above.
+			if err := s.reopenIfRotated(); err != nil {
+				return err
+			}
+		}
+		p.flush()
+	}
+}
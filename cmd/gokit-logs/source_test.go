@@ -0,0 +1,139 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func writeLog(t *testing.T, path string, modTime time.Time, msgs ...string) {
+	var b bytes.Buffer
+	for _, msg := range msgs {
+		b.WriteString(`{"level":"INFO","time":"2026-10-18 ` + msg + `.0000000","msg":"` + msg + "\"}\n")
+	}
+	content := b.Bytes()
+	if strings.HasSuffix(path, ".gz") {
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		zw.Write(content)
+		zw.Close()
+		content = gz.Bytes()
+	}
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type recorder struct {
+	msgs []string
+}
+
+func (r *recorder) print(e *entry) {
+	r.msgs = append(r.msgs, e.builtin("message"))
+}
+
+func (r *recorder) flush() {}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2026, 10, 18, 0, 0, 0, 0, time.Local)
+	writeLog(t, filepath.Join(dir, "info-2026-10-18T01-00-00.000.log.gz"), base.Add(time.Hour), "00:00:01", "00:00:03")
+	writeLog(t, filepath.Join(dir, "info-2026-10-18T02-00-00.000.log"), base.Add(2*time.Hour), "00:00:05")
+	writeLog(t, filepath.Join(dir, "info.log"), base.Add(3*time.Hour), "00:00:07")
+	writeLog(t, filepath.Join(dir, "warn-2026-10-18.log"), base.Add(time.Hour), "00:00:02")
+	writeLog(t, filepath.Join(dir, "warn-2026-10-18.1.log"), base.Add(time.Hour), "00:00:04")
+	writeLog(t, filepath.Join(dir, "warn.log"), base.Add(3*time.Hour), "00:00:06")
+	writeLog(t, filepath.Join(dir, "other.log"), base, "00:00:00")
+
+	var sources []*source
+	for _, name := range []string{"info.log", "warn.log"} {
+		path := filepath.Join(dir, name)
+		backups, err := backupsOf(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, newSource(append(backups, path), defaultLayout))
+	}
+	r := &recorder{}
+	if err := merge(sources, &filter{}, r); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"00:00:01", "00:00:02", "00:00:03", "00:00:04", "00:00:05", "00:00:06", "00:00:07"}
+	if !reflect.DeepEqual(r.msgs, want) {
+		t.Errorf("merge() = %v, want %v", r.msgs, want)
+	}
+}
+
+func TestParseEntryLayout(t *testing.T) {
+	want := time.Date(2026, 10, 18, 8, 30, 0, 123000000, time.Local)
+	tests := []struct {
+		name       string
+		keys       map[string]string
+		timeFormat string
+		line       string
+	}{
+		{"Default", nil, "", `{"level":"WARN","time":"2026-10-18 08:30:00.1230000","msg":"hello","n":1}`},
+		{"Keys", map[string]string{"time": "ts", "level": "severity", "message": "message"}, "",
+			`{"severity":"WARN","ts":"2026-10-18 08:30:00.1230000","message":"hello","n":1}`},
+		{"Colored", nil, "", `{"level":"\u001b[33mWARN\u001b[0m","time":"2026-10-18 08:30:00.1230000","msg":"hello","n":1}`},
+		{"Epoch", nil, "epoch", fmt.Sprintf(`{"level":"WARN","time":%d.123,"msg":"hello","n":1}`, want.Unix())},
+		{"EpochMillis", nil, "epoch_millis", fmt.Sprintf(`{"level":"WARN","time":%d,"msg":"hello","n":1}`, want.UnixMilli())},
+		{"EpochNanosGuessed", nil, "", fmt.Sprintf(`{"level":"WARN","time":%d,"msg":"hello","n":1}`, want.UnixNano())},
+		{"Layout", nil, "02/01/2006 15:04:05.000", `{"level":"WARN","time":"18/10/2026 08:30:00.123","msg":"hello","n":1}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := newLayout(tt.keys, tt.timeFormat)
+			if err != nil {
+				t.Fatalf("newLayout() error = %v", err)
+			}
+			e, ok := parseEntry([]byte(tt.line), l)
+			if !ok {
+				t.Fatalf("parseEntry() failed")
+			}
+			if e.level != zapcore.WarnLevel {
+				t.Errorf("level = %v, want warn", e.level)
+			}
+			if d := e.time.Sub(want); d < -time.Millisecond || d > time.Millisecond {
+				t.Errorf("time = %v, want %v", e.time, want)
+			}
+			if got := e.builtin("message"); got != "hello" {
+				t.Errorf("message = %v, want hello", got)
+			}
+			if got := fieldsOf(e); got != "n=1" {
+				t.Errorf("fieldsOf() = %v, want n=1", got)
+			}
+		})
+	}
+	if _, err := newLayout(map[string]string{"msg": "message"}, ""); err == nil {
+		t.Errorf("newLayout() error = nil, want error for a key not in log.keys")
+	}
+}
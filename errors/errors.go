@@ -0,0 +1,253 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+// Package errors provides errors carrying a code, key/value fields, a cause and
+// the stack where they were created.
+//
+// The kit's logger encodes them in structured form:
+//
+//	err := errors.Wrap(dbErr, errors.Unavailable, "load user", "id", 42)
+//	log.Error("request failed", zap.Error(err))
+//	// {"error": "load user: connection refused", "errorDetails": {"code": "Unavailable", "fields": {"id": 42}, "stack": "...", ...}}
+package errors
+
+import (
+	stderrors "errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Code classifies an error.
+type Code string
+
+const (
+	Unknown            Code = "Unknown"
+	InvalidArgument    Code = "InvalidArgument"
+	NotFound           Code = "NotFound"
+	AlreadyExists      Code = "AlreadyExists"
+	Conflict           Code = "Conflict"
+	PermissionDenied   Code = "PermissionDenied"
+	Unauthenticated    Code = "Unauthenticated"
+	FailedPrecondition Code = "FailedPrecondition"
+	ResourceExhausted  Code = "ResourceExhausted"
+	Canceled           Code = "Canceled"
+	DeadlineExceeded   Code = "DeadlineExceeded"
+	Unimplemented      Code = "Unimplemented"
+	Unavailable        Code = "Unavailable"
+	Internal           Code = "Internal"
+)
+
+// maxStackDepth bounds the number of frames captured per error.
+const maxStackDepth = 32
+
+// Error is an error with a code, fields, an optional cause and a stack.
+type Error struct {
+	code   Code
+	msg    string
+	fields []interface{}
+	cause  error
+	stack  []uintptr
+}
+
+var _ zapcore.ObjectMarshaler = (*Error)(nil)
+
+// New returns an error with code and msg, keysAndValues are attached as fields.
+func New(code Code, msg string, keysAndValues ...interface{}) *Error {
+	return &Error{code: code, msg: msg, fields: keysAndValues, stack: callers()}
+}
+
+// Newf returns an error with code and a formatted message.
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return &Error{code: code, msg: fmt.Sprintf(format, args...), stack: callers()}
+}
+
+// Wrap returns an *Error with code and msg caused by err, or nil if err is nil.
+// An empty code inherits the code of err.
+func Wrap(err error, code Code, msg string, keysAndValues ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{code: code, msg: msg, fields: keysAndValues, cause: err, stack: callers()}
+}
+
+// Wrapf returns an *Error with code and a formatted message caused by err, or nil if err is nil.
+func Wrapf(err error, code Code, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{code: code, msg: fmt.Sprintf(format, args...), cause: err, stack: callers()}
+}
+
+func callers() []uintptr {
+	pcs := make([]uintptr, maxStackDepth)
+	// skip runtime.Callers, callers and the constructor.
+	n := runtime.Callers(3, pcs)
+	return pcs[:n]
+}
+
+// With returns a copy of e with more fields.
+func (e *Error) With(keysAndValues ...interface{}) *Error {
+	c := *e
+	c.fields = append(append([]interface{}(nil), e.fields...), keysAndValues...)
+	return &c
+}
+
+func (e *Error) Error() string {
+	if e.cause == nil {
+		return e.msg
+	}
+	if e.msg == "" {
+		return e.cause.Error()
+	}
+	return e.msg + ": " + e.cause.Error()
+}
+
+// Unwrap returns the cause.
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Code returns the code of e, or of its cause if it has none.
+func (e *Error) Code() Code {
+	if e.code != "" {
+		return e.code
+	}
+	if e.cause == nil {
+		return Unknown
+	}
+	return CodeOf(e.cause)
+}
+
+// Fields returns the fields of e and its causes, the outer ones win.
+func (e *Error) Fields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	for err := error(e); err != nil; err = stderrors.Unwrap(err) {
+		ke, ok := err.(*Error)
+		if !ok {
+			continue
+		}
+		for i := 0; i < len(ke.fields); i += 2 {
+			key := fmt.Sprint(ke.fields[i])
+			if _, ok := fields[key]; ok {
+				continue
+			}
+			if i+1 < len(ke.fields) {
+				fields[key] = ke.fields[i+1]
+			} else {
+				fields[key] = nil
+			}
+		}
+	}
+	return fields
+}
+
+// Stack formats the stack of the innermost Error in the chain.
+func (e *Error) Stack() string {
+	inner := e
+	for err := e.cause; err != nil; err = stderrors.Unwrap(err) {
+		if ke, ok := err.(*Error); ok {
+			inner = ke
+		}
+	}
+
+	var b strings.Builder
+	frames := runtime.CallersFrames(inner.stack)
+	for {
+		f, more := frames.Next()
+		b.WriteString(f.Function)
+		b.WriteString("\n\t")
+		b.WriteString(f.File)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(f.Line))
+		if !more {
+			break
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// MarshalLogObject encodes the code, fields, cause chain and stack of e.
+func (e *Error) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("code", string(e.Code()))
+	if fields := e.Fields(); len(fields) > 0 {
+		if err := enc.AddReflected("fields", fields); err != nil {
+			return err
+		}
+	}
+	if e.cause != nil {
+		if err := enc.AddArray("causes", causes{e.cause}); err != nil {
+			return err
+		}
+	}
+	enc.AddString("stack", e.Stack())
+	return nil
+}
+
+// causes encodes the cause chain, outermost first.
+type causes struct {
+	err error
+}
+
+func (c causes) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	for err := c.err; err != nil; err = stderrors.Unwrap(err) {
+		if ke, ok := err.(*Error); ok {
+			enc.AppendString(string(ke.Code()) + ": " + ke.msg)
+			continue
+		}
+		enc.AppendString(err.Error())
+	}
+	return nil
+}
+
+// CodeOf returns the code of the first error in the chain of err with a Code method,
+// such as Error, Unknown if there is none and "" if err is nil.
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	var coder interface{ Code() Code }
+	if stderrors.As(err, &coder) {
+		return coder.Code()
+	}
+	return Unknown
+}
+
+// IsCode reports whether err has code.
+func IsCode(err error, code Code) bool {
+	return CodeOf(err) == code
+}
+
+// Is reports whether any error in err's chain matches target, see errors.Is.
+func Is(err, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+// As finds the first error in err's chain that matches target, see errors.As.
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
+}
+
+// Unwrap returns the cause of err, see errors.Unwrap.
+func Unwrap(err error) error {
+	return stderrors.Unwrap(err)
+}
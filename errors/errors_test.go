@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package errors
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestWrap(t *testing.T) {
+	inner := New(NotFound, "user not found", "id", 42)
+	tests := []struct {
+		name       string
+		err        error
+		wantMsg    string
+		wantCode   Code
+		wantStatus int
+		wantFields map[string]interface{}
+	}{
+		{"New", inner, "user not found", NotFound, http.StatusNotFound, map[string]interface{}{"id": 42}},
+		{"InheritCode", Wrap(inner, "", "load user", "tenant", "a"), "load user: user not found", NotFound, http.StatusNotFound,
+			map[string]interface{}{"id": 42, "tenant": "a"}},
+		{"OverrideCode", Wrap(inner, Internal, "load user", "id", 7), "load user: user not found", Internal, http.StatusInternalServerError,
+			map[string]interface{}{"id": 7}},
+		{"Plain", Wrap(io.EOF, Unavailable, "read"), "read: EOF", Unavailable, http.StatusServiceUnavailable, map[string]interface{}{}},
+		{"Foreign", io.EOF, "EOF", Unknown, http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.wantMsg {
+				t.Errorf("Error() = %v, want %v", got, tt.wantMsg)
+			}
+			if got := CodeOf(tt.err); got != tt.wantCode {
+				t.Errorf("CodeOf() = %v, want %v", got, tt.wantCode)
+			}
+			if got := StatusOf(tt.err); got != tt.wantStatus {
+				t.Errorf("StatusOf() = %v, want %v", got, tt.wantStatus)
+			}
+			var e *Error
+			if !As(tt.err, &e) {
+				return
+			}
+			fields := e.Fields()
+			if len(fields) != len(tt.wantFields) {
+				t.Errorf("Fields() = %v, want %v", fields, tt.wantFields)
+			}
+			for k, v := range tt.wantFields {
+				if fields[k] != v {
+					t.Errorf("Fields()[%s] = %v, want %v", k, fields[k], v)
+				}
+			}
+		})
+	}
+	if Wrap(nil, Internal, "nothing") != nil {
+		t.Errorf("Wrap(nil) is not nil")
+	}
+}
+
+func TestMarshalLogObject(t *testing.T) {
+	err := Wrap(New(InvalidArgument, "bad name", "name", "x"), "", "create job")
+	enc := zapcore.NewMapObjectEncoder()
+	if merr := err.(*Error).MarshalLogObject(enc); merr != nil {
+		t.Fatal(merr)
+	}
+	if enc.Fields["code"] != string(InvalidArgument) {
+		t.Errorf("code = %v, want %v", enc.Fields["code"], InvalidArgument)
+	}
+	if fields, _ := enc.Fields["fields"].(map[string]interface{}); fields["name"] != "x" {
+		t.Errorf("fields = %v, want name: x", enc.Fields["fields"])
+	}
+	if causes, _ := enc.Fields["causes"].([]interface{}); len(causes) != 1 || causes[0] != "InvalidArgument: bad name" {
+		t.Errorf("causes = %v", enc.Fields["causes"])
+	}
+	if stack, _ := enc.Fields["stack"].(string); !strings.Contains(stack, "TestMarshalLogObject") {
+		t.Errorf("stack = %v, want the test function", stack)
+	}
+}
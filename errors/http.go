@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package errors
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+var httpStatus = map[Code]int{
+	Unknown:            http.StatusInternalServerError,
+	InvalidArgument:    http.StatusBadRequest,
+	NotFound:           http.StatusNotFound,
+	AlreadyExists:      http.StatusConflict,
+	Conflict:           http.StatusConflict,
+	PermissionDenied:   http.StatusForbidden,
+	Unauthenticated:    http.StatusUnauthorized,
+	FailedPrecondition: http.StatusPreconditionFailed,
+	ResourceExhausted:  http.StatusTooManyRequests,
+	// nginx's "client closed request", there is no standard status for it.
+	Canceled:         499,
+	DeadlineExceeded: http.StatusGatewayTimeout,
+	Unimplemented:    http.StatusNotImplemented,
+	Unavailable:      http.StatusServiceUnavailable,
+	Internal:         http.StatusInternalServerError,
+}
+
+// HTTPStatus maps code to an HTTP status, unknown codes map to 500.
+func HTTPStatus(code Code) int {
+	if status, ok := httpStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// StatusOf returns the HTTP status of err, 200 if err is nil.
+func StatusOf(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	return HTTPStatus(CodeOf(err))
+}
+
+// CodeOfStatus maps an HTTP status back to a code, "" for statuses below 400.
+func CodeOfStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return InvalidArgument
+	case http.StatusUnauthorized:
+		return Unauthenticated
+	case http.StatusForbidden:
+		return PermissionDenied
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusPreconditionFailed:
+		return FailedPrecondition
+	case http.StatusTooManyRequests:
+		return ResourceExhausted
+	case 499:
+		return Canceled
+	case http.StatusNotImplemented:
+		return Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return Unavailable
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return DeadlineExceeded
+	}
+	switch {
+	case status >= http.StatusInternalServerError:
+		return Internal
+	case status >= http.StatusBadRequest:
+		return InvalidArgument
+	}
+	return ""
+}
+
+// Problem is an RFC 7807 problem details body.
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Code is an extension member carrying the error code.
+	Code Code `json:"code,omitempty"`
+}
+
+// ProblemContentType is the media type of Problem bodies.
+const ProblemContentType = "application/problem+json"
+
+// WriteHTTP writes err as an application/problem+json response with the status of its code.
+// The message of 5xx errors is not exposed to the client.
+func WriteHTTP(w http.ResponseWriter, err error) {
+	status := StatusOf(err)
+	p := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   CodeOf(err),
+	}
+	if status < http.StatusInternalServerError && err != nil {
+		p.Detail = err.Error()
+	}
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// Retry strategies of http.retries.strategy.
+const (
+	// StrategyNone waits MinDelay before every retry.
+	StrategyNone = "none"
+	// StrategyLinear waits MinDelay, then Multiplier*MinDelay longer on every retry.
+	StrategyLinear = "linear"
+	// StrategyLinearRandom waits a random delay between MinDelay and the linear one.
+	StrategyLinearRandom = "linear_random"
+	// StrategyExponential waits MinDelay, then Multiplier times longer on every retry.
+	StrategyExponential = "exponential"
+	// StrategyExponentialRandom waits a random delay between MinDelay and the exponential one.
+	StrategyExponentialRandom = "exponential_random"
+	// StrategyDecorrelatedJitter waits a random delay between MinDelay and Multiplier times the previous one.
+	StrategyDecorrelatedJitter = "decorrelated_jitter"
+)
+
+// BackoffConfig configures NewBackoff, every delay is capped at MaxDelay.
+type BackoffConfig struct {
+	Strategy string
+	MinDelay time.Duration
+	MaxDelay time.Duration
+	// Multiplier defaults to 1 for the linear strategies, 2 for the exponential ones and 3 for decorrelated jitter.
+	Multiplier float64
+	// Rand returns a number in [0, 1), defaults to rand.Float64. It must be safe for concurrent use.
+	Rand func() float64
+}
+
+// Backoff returns the delay before a retry.
+type Backoff interface {
+	// Delay returns the delay before the retry following attempt, attempts start at 1.
+	Delay(attempt int) time.Duration
+}
+
+// NewBackoff returns the Backoff of cfg.Strategy.
+func NewBackoff(cfg BackoffConfig) (Backoff, error) {
+	if cfg.MaxDelay <= 0 || cfg.MaxDelay < cfg.MinDelay {
+		cfg.MaxDelay = cfg.MinDelay
+	}
+	if cfg.Rand == nil {
+		cfg.Rand = rand.Float64
+	}
+	if cfg.Multiplier <= 0 {
+		switch cfg.Strategy {
+		case StrategyExponential, StrategyExponentialRandom:
+			cfg.Multiplier = 2
+		case StrategyDecorrelatedJitter:
+			cfg.Multiplier = 3
+		default:
+			cfg.Multiplier = 1
+		}
+	}
+
+	b := &backoff{cfg: cfg}
+	switch cfg.Strategy {
+	case StrategyNone, "":
+		b.delay = b.none
+	case StrategyLinear:
+		b.delay = b.linear
+	case StrategyLinearRandom:
+		b.delay = b.randomize(b.linear)
+	case StrategyExponential:
+		b.delay = b.exponential
+	case StrategyExponentialRandom:
+		b.delay = b.randomize(b.exponential)
+	case StrategyDecorrelatedJitter:
+		b.delay = b.decorrelatedJitter
+	default:
+		return nil, fmt.Errorf("unknown retry strategy %q", cfg.Strategy)
+	}
+	return b, nil
+}
+
+type backoff struct {
+	cfg   BackoffConfig
+	delay func(attempt int) float64
+}
+
+func (b *backoff) Delay(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := math.Min(b.delay(attempt), float64(b.cfg.MaxDelay))
+	return time.Duration(math.Max(d, float64(b.cfg.MinDelay)))
+}
+
+func (b *backoff) none(int) float64 {
+	return float64(b.cfg.MinDelay)
+}
+
+func (b *backoff) linear(attempt int) float64 {
+	return float64(b.cfg.MinDelay) * (1 + b.cfg.Multiplier*float64(attempt-1))
+}
+
+func (b *backoff) exponential(attempt int) float64 {
+	return float64(b.cfg.MinDelay) * math.Pow(b.cfg.Multiplier, float64(attempt-1))
+}
+
+// randomize returns a delay between MinDelay and the one of delay.
+func (b *backoff) randomize(delay func(attempt int) float64) func(attempt int) float64 {
+	return func(attempt int) float64 {
+		min := float64(b.cfg.MinDelay)
+		max := math.Min(delay(attempt), float64(b.cfg.MaxDelay))
+		return min + b.cfg.Rand()*(max-min)
+	}
+}
+
+// decorrelatedJitter replays the chain of delays up to attempt, so that it needs no state per request.
+// See https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/.
+func (b *backoff) decorrelatedJitter(attempt int) float64 {
+	min, max := float64(b.cfg.MinDelay), float64(b.cfg.MaxDelay)
+	d := min
+	for i := 0; i < attempt; i++ {
+		d = math.Min(max, min+b.cfg.Rand()*(d*b.cfg.Multiplier-min))
+	}
+	return d
+}
+
+// retryAfter adapts b to resty's SetRetryAfter.
+func retryAfter(b Backoff) resty.RetryAfterFunc {
+	return func(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+		attempt := 1
+		if resp != nil && resp.Request != nil {
+			attempt = resp.Request.Attempt
+		}
+		// resty uses its own backoff for 0.
+		if d := b.Delay(attempt); d > 0 {
+			return d, nil
+		}
+		return time.Nanosecond, nil
+	}
+}
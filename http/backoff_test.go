@@ -0,0 +1,118 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func TestBackoff(t *testing.T) {
+	const ms = time.Millisecond
+	half := func() float64 { return 0.5 }
+	tests := []struct {
+		name string
+		cfg  BackoffConfig
+		want []time.Duration
+	}{
+		{"None", BackoffConfig{Strategy: StrategyNone, MinDelay: 100 * ms}, []time.Duration{100 * ms, 100 * ms, 100 * ms}},
+		{"Linear", BackoffConfig{Strategy: StrategyLinear, MinDelay: 100 * ms, MaxDelay: 250 * ms},
+			[]time.Duration{100 * ms, 200 * ms, 250 * ms}},
+		{"LinearMultiplier", BackoffConfig{Strategy: StrategyLinear, MinDelay: 100 * ms, MaxDelay: time.Second, Multiplier: 0.5},
+			[]time.Duration{100 * ms, 150 * ms, 200 * ms}},
+		{"LinearRandom", BackoffConfig{Strategy: StrategyLinearRandom, MinDelay: 100 * ms, MaxDelay: time.Second, Rand: half},
+			[]time.Duration{100 * ms, 150 * ms, 200 * ms}},
+		{"Exponential", BackoffConfig{Strategy: StrategyExponential, MinDelay: 100 * ms, MaxDelay: 300 * ms},
+			[]time.Duration{100 * ms, 200 * ms, 300 * ms}},
+		{"ExponentialRandom", BackoffConfig{Strategy: StrategyExponentialRandom, MinDelay: 100 * ms, MaxDelay: time.Second, Rand: half},
+			[]time.Duration{100 * ms, 150 * ms, 250 * ms}},
+		{"DecorrelatedJitter", BackoffConfig{Strategy: StrategyDecorrelatedJitter, MinDelay: 100 * ms, MaxDelay: time.Second, Rand: half},
+			[]time.Duration{200 * ms, 350 * ms, 575 * ms}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewBackoff(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewBackoff() error = %v", err)
+			}
+			var got []time.Duration
+			for attempt := 1; attempt <= len(tt.want); attempt++ {
+				got = append(got, b.Delay(attempt))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Delay() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewBackoff(BackoffConfig{Strategy: "fibonacci"}); err == nil {
+		t.Errorf("NewBackoff() with an unknown strategy succeeded")
+	}
+}
+
+func TestBackoffBounds(t *testing.T) {
+	// a seeded source is deterministic, but only the bounds matter here.
+	r := rand.New(rand.NewSource(1))
+	for _, strategy := range []string{StrategyLinearRandom, StrategyExponentialRandom, StrategyDecorrelatedJitter} {
+		b, _ := NewBackoff(BackoffConfig{Strategy: strategy, MinDelay: 10 * time.Millisecond, MaxDelay: time.Second, Rand: r.Float64})
+		for attempt := 1; attempt <= 20; attempt++ {
+			if d := b.Delay(attempt); d < 10*time.Millisecond || d > time.Second {
+				t.Errorf("%s Delay(%d) = %v, out of [10ms, 1s]", strategy, attempt, d)
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	var delays []time.Duration
+	b, _ := NewBackoff(BackoffConfig{Strategy: StrategyLinear, MinDelay: time.Millisecond, MaxDelay: time.Second})
+	after := retryAfter(b)
+	c := resty.New().
+		SetRetryCount(3).
+		SetRetryAfter(func(c *resty.Client, resp *resty.Response) (time.Duration, error) {
+			d, err := after(c, resp)
+			delays = append(delays, d)
+			return d, err
+		}).
+		AddRetryCondition(func(resp *resty.Response, err error) bool {
+			return err != nil || resp.StatusCode() != http.StatusOK
+		})
+
+	resp, err := c.R().Get(srv.URL)
+	if err != nil || resp.StatusCode() != http.StatusOK {
+		t.Fatalf("Get() = %v, %v", resp, err)
+	}
+	if want := []time.Duration{time.Millisecond, 2 * time.Millisecond}; !reflect.DeepEqual(delays, want) {
+		t.Errorf("delays = %v, want %v", delays, want)
+	}
+}
@@ -0,0 +1,352 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/errors"
+	"github.com/cauwulixuan/go-kit/log"
+	"github.com/cauwulixuan/go-kit/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	breakerState = metrics.Factory().NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "http_client",
+		Name:      "circuit_state",
+		Help:      "State of the circuit breaker of a client for an upstream host, 0 closed, 1 open and 2 half-open.",
+	}, []string{"client", "host"})
+	breakerTransitions = metrics.Factory().NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "http_client",
+		Name:      "circuit_transitions_total",
+		Help:      "Number of state changes of the circuit breaker of a client for an upstream host.",
+	}, []string{"client", "host", "from", "to"})
+	breakerRejected = metrics.Factory().NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "http_client",
+		Name:      "circuit_rejected_total",
+		Help:      "Number of requests failed fast by the circuit breaker of a client for an upstream host.",
+	}, []string{"client", "host"})
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	// BreakerClosed lets all requests through.
+	BreakerClosed BreakerState = iota
+	// BreakerOpen fails all requests fast.
+	BreakerOpen
+	// BreakerHalfOpen lets a few probes through to decide whether to close or open again.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(s))
+}
+
+// BreakerConfig sets when a circuit opens and how it recovers.
+// Transport errors and 5xx responses are failures, requests canceled by the caller are not counted.
+type BreakerConfig struct {
+	// Client names the client in the metrics, so that the breakers of clients sharing a host are told apart.
+	Client string
+	// ConsecutiveFailures opens the circuit after as many failures in a row, 0 does not.
+	ConsecutiveFailures int
+	// FailureRate opens the circuit once the failures reach it within Window, 0 does not.
+	FailureRate float64
+	// Window is the sliding window of FailureRate, 1m if 0.
+	Window time.Duration
+	// MinRequests within Window before FailureRate applies, 10 if 0.
+	MinRequests int
+	// OpenTimeout is how long an open circuit fails fast before letting probes through, 30s if 0.
+	OpenTimeout time.Duration
+	// HalfOpenRequests is the number of probes let through at once, all of them must succeed
+	// to close the circuit. 1 if 0.
+	HalfOpenRequests int
+}
+
+// withDefaults fills in the zero settings, opening after 5 failures in a row if no threshold is set.
+func (c BreakerConfig) withDefaults() BreakerConfig {
+	if c.ConsecutiveFailures <= 0 && c.FailureRate <= 0 {
+		c.ConsecutiveFailures = 5
+	}
+	if c.Window <= 0 {
+		c.Window = time.Minute
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 10
+	}
+	if c.OpenTimeout <= 0 {
+		c.OpenTimeout = 30 * time.Second
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+	return c
+}
+
+// CircuitOpenError is returned for the requests failed fast by an open circuit.
+type CircuitOpenError struct {
+	Host string
+	// Until is when the circuit lets probes through again.
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker of %s is open until %s", e.Host, e.Until.Format(time.RFC3339))
+}
+
+// Code returns Unavailable.
+func (e *CircuitOpenError) Code() errors.Code {
+	return errors.Unavailable
+}
+
+// outcome is the result of a request let through by a Breaker.
+type outcome int
+
+const (
+	success outcome = iota
+	failure
+	// ignored releases the request without counting it.
+	ignored
+)
+
+// breakerBuckets divide the sliding window of a Breaker.
+const breakerBuckets = 10
+
+type breakerBucket struct {
+	epoch              int64
+	requests, failures int
+}
+
+// Breaker is the circuit breaker of an upstream host.
+type Breaker struct {
+	host string
+	cfg  BreakerConfig
+	now  func() time.Time
+
+	mu          sync.Mutex
+	state       BreakerState
+	generation  uint64
+	openedAt    time.Time
+	consecutive int
+	buckets     [breakerBuckets]breakerBucket
+	probes      int
+	succeeded   int
+}
+
+// NewBreaker returns a closed Breaker of host.
+func NewBreaker(host string, cfg BreakerConfig) *Breaker {
+	breakerState.WithLabelValues(cfg.Client, host).Set(float64(BreakerClosed))
+	return &Breaker{host: host, cfg: cfg.withDefaults(), now: time.Now}
+}
+
+// State returns the current state of b.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.halfOpenIfDue(b.now())
+	return b.state
+}
+
+// allow lets a request through, or fails it fast with a *CircuitOpenError.
+// done must be called with the outcome of a request let through.
+func (b *Breaker) allow() (done func(outcome), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	b.halfOpenIfDue(now)
+	switch {
+	case b.state == BreakerOpen, b.state == BreakerHalfOpen && b.probes >= b.cfg.HalfOpenRequests:
+		breakerRejected.WithLabelValues(b.cfg.Client, b.host).Inc()
+		return nil, &CircuitOpenError{Host: b.host, Until: b.openedAt.Add(b.cfg.OpenTimeout)}
+	case b.state == BreakerHalfOpen:
+		b.probes++
+	}
+	generation := b.generation
+	var once sync.Once
+	return func(o outcome) {
+		once.Do(func() { b.done(generation, o) })
+	}, nil
+}
+
+func (b *Breaker) done(generation uint64, o outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// requests let through before the last state change do not count.
+	if generation != b.generation {
+		return
+	}
+	now := b.now()
+	switch b.state {
+	case BreakerClosed:
+		if o == ignored {
+			return
+		}
+		b.count(now, o == failure)
+		if o == success {
+			b.consecutive = 0
+		} else {
+			b.consecutive++
+		}
+		if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+			b.setState(BreakerOpen, now, fmt.Sprintf("%d consecutive failures", b.consecutive))
+		} else if requests, failures := b.window(now); b.cfg.FailureRate > 0 && requests >= b.cfg.MinRequests &&
+			float64(failures) >= b.cfg.FailureRate*float64(requests) {
+			b.setState(BreakerOpen, now, fmt.Sprintf("%d failures of %d requests within %v", failures, requests, b.cfg.Window))
+		}
+	case BreakerHalfOpen:
+		b.probes--
+		switch o {
+		case failure:
+			b.setState(BreakerOpen, now, "a probe failed")
+		case success:
+			b.succeeded++
+			if b.succeeded >= b.cfg.HalfOpenRequests {
+				b.setState(BreakerClosed, now, fmt.Sprintf("%d probes succeeded", b.succeeded))
+			}
+		}
+	}
+}
+
+func (b *Breaker) halfOpenIfDue(now time.Time) {
+	if b.state == BreakerOpen && !now.Before(b.openedAt.Add(b.cfg.OpenTimeout)) {
+		b.setState(BreakerHalfOpen, now, fmt.Sprintf("open for %v", b.cfg.OpenTimeout))
+	}
+}
+
+// setState moves b to state, the requests in flight are not counted afterwards.
+func (b *Breaker) setState(state BreakerState, now time.Time, reason string) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.probes, b.succeeded = 0, 0
+	switch state {
+	case BreakerOpen:
+		b.openedAt = now
+		log.Slogger.Warnf("Circuit breaker of %s opened after %s, failing requests fast for %v", b.host, reason, b.cfg.OpenTimeout)
+	case BreakerClosed:
+		b.consecutive = 0
+		b.buckets = [breakerBuckets]breakerBucket{}
+		log.Slogger.Infof("Circuit breaker of %s closed after %s", b.host, reason)
+	default:
+		log.Slogger.Infof("Circuit breaker of %s half-open after %s, letting %d probes through", b.host, reason, b.cfg.HalfOpenRequests)
+	}
+	breakerState.WithLabelValues(b.cfg.Client, b.host).Set(float64(state))
+	breakerTransitions.WithLabelValues(b.cfg.Client, b.host, from.String(), state.String()).Inc()
+}
+
+func (b *Breaker) epoch(now time.Time) int64 {
+	width := b.cfg.Window / breakerBuckets
+	if width <= 0 {
+		width = 1
+	}
+	return now.UnixNano() / int64(width)
+}
+
+func (b *Breaker) count(now time.Time, failed bool) {
+	epoch := b.epoch(now)
+	bucket := &b.buckets[epoch%breakerBuckets]
+	if bucket.epoch != epoch {
+		*bucket = breakerBucket{epoch: epoch}
+	}
+	bucket.requests++
+	if failed {
+		bucket.failures++
+	}
+}
+
+// window sums the requests and failures within the sliding window.
+func (b *Breaker) window(now time.Time) (requests, failures int) {
+	epoch := b.epoch(now)
+	for _, bucket := range b.buckets {
+		if epoch-bucket.epoch < breakerBuckets {
+			requests += bucket.requests
+			failures += bucket.failures
+		}
+	}
+	return requests, failures
+}
+
+// breakerTransport is a http.RoundTripper with a Breaker per upstream host.
+type breakerTransport struct {
+	cfg  BreakerConfig
+	next http.RoundTripper
+
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// NewBreakerTransport returns a http.RoundTripper sending the requests with next,
+// behind a circuit breaker of cfg per upstream host.
+func NewBreakerTransport(cfg BreakerConfig, next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &breakerTransport{cfg: cfg, next: next, breakers: make(map[string]*Breaker)}
+}
+
+func (t *breakerTransport) breaker(host string) *Breaker {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	b, ok := t.breakers[host]
+	if !ok {
+		b = NewBreaker(host, t.cfg)
+		t.breakers[host] = b
+	}
+	return b
+}
+
+func (t *breakerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	done, err := t.breaker(r.URL.Host).allow()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.next.RoundTrip(r)
+	switch {
+	case err != nil && (r.Context().Err() != nil || errors.Is(err, context.Canceled)):
+		done(ignored)
+	case err != nil, resp.StatusCode >= http.StatusInternalServerError:
+		done(failure)
+	default:
+		done(success)
+	}
+	return resp, err
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (t *breakerTransport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
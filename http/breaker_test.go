@@ -0,0 +1,158 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/log/logtest"
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestBreaker(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      BreakerConfig
+		outcomes []outcome
+		want     BreakerState
+	}{
+		{"ConsecutiveFailures", BreakerConfig{ConsecutiveFailures: 3}, []outcome{failure, failure, failure}, BreakerOpen},
+		{"SuccessResetsConsecutive", BreakerConfig{ConsecutiveFailures: 3}, []outcome{failure, failure, success, failure, failure}, BreakerClosed},
+		{"IgnoredNotCounted", BreakerConfig{ConsecutiveFailures: 2}, []outcome{failure, ignored, ignored}, BreakerClosed},
+		{"FailureRate", BreakerConfig{FailureRate: 0.5, MinRequests: 4}, []outcome{failure, success, failure, success}, BreakerOpen},
+		{"BelowMinRequests", BreakerConfig{FailureRate: 0.5, MinRequests: 4}, []outcome{failure, failure, failure}, BreakerClosed},
+		{"BelowFailureRate", BreakerConfig{FailureRate: 0.5, MinRequests: 4}, []outcome{failure, success, success, success, failure}, BreakerClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logtest.New(t)
+			b := NewBreaker(tt.name, tt.cfg)
+			for _, o := range tt.outcomes {
+				done, err := b.allow()
+				if err != nil {
+					t.Fatalf("allow() error = %v", err)
+				}
+				done(o)
+			}
+			if got := b.State(); got != tt.want {
+				t.Errorf("State() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerRecovery(t *testing.T) {
+	logs := logtest.New(t)
+	now := time.Now()
+	b := NewBreaker("recovery", BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Minute, HalfOpenRequests: 2})
+	b.now = func() time.Time { return now }
+
+	done, _ := b.allow()
+	// let through before the circuit opens, counted in no state.
+	stale, _ := b.allow()
+	done(failure)
+	var openErr *CircuitOpenError
+	if _, err := b.allow(); !errors.As(err, &openErr) || !openErr.Until.Equal(now.Add(time.Minute)) {
+		t.Fatalf("allow() error = %v, want the circuit open for a minute", err)
+	}
+	stale(success)
+	if got := logs.Filter(zapcore.WarnLevel, "Circuit breaker of recovery opened after 1 consecutive failures, failing requests fast for 1m0s"); len(got) != 1 {
+		t.Errorf("logged %v, want the circuit opened once", logs)
+	}
+
+	now = now.Add(time.Minute)
+	if got := b.State(); got != BreakerHalfOpen {
+		t.Fatalf("State() = %v, want %v", got, BreakerHalfOpen)
+	}
+	probe1, _ := b.allow()
+	probe2, _ := b.allow()
+	if _, err := b.allow(); err == nil {
+		t.Errorf("allow() let a third probe through")
+	}
+	probe1(success)
+	probe2(failure)
+	if got := b.State(); got != BreakerOpen {
+		t.Fatalf("State() after a failed probe = %v, want %v", got, BreakerOpen)
+	}
+
+	now = now.Add(time.Minute)
+	probe1, _ = b.allow()
+	probe2, _ = b.allow()
+	probe1(success)
+	probe2(success)
+	if got := b.State(); got != BreakerClosed {
+		t.Errorf("State() after the probes succeeded = %v, want %v", got, BreakerClosed)
+	}
+}
+
+func TestBreakerTransport(t *testing.T) {
+	logtest.New(t)
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	c := resty.New().SetRetryCount(3).SetRetryWaitTime(time.Millisecond)
+	b, _ := NewBackoff(BackoffConfig{Strategy: StrategyNone, MinDelay: time.Millisecond})
+	(&RetryPolicy{Statuses: DefaultRetryStatuses, Backoff: b}).Apply(c)
+	c.SetTransport(NewBreakerTransport(BreakerConfig{ConsecutiveFailures: 2}, c.GetClient().Transport))
+
+	// the second attempt opens the circuit, the third one fails fast and is not retried.
+	_, err := c.R().Get(srv.URL)
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("Get() error = %v, want a *CircuitOpenError", err)
+	}
+	if _, err := c.R().Get(srv.URL); !errors.As(err, &openErr) {
+		t.Errorf("Get() error = %v, want a *CircuitOpenError", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %v, want 2", calls)
+	}
+}
+
+func TestBreakerClients(t *testing.T) {
+	logtest.New(t)
+	orders := NewBreaker("shared", BreakerConfig{Client: "orders", ConsecutiveFailures: 1})
+	done, _ := orders.allow()
+	done(failure)
+	// a breaker of another client for the same host leaves the state of orders as is.
+	NewBreaker("shared", BreakerConfig{Client: "users"})
+
+	tests := []struct {
+		client string
+		want   BreakerState
+	}{
+		{"orders", BreakerOpen},
+		{"users", BreakerClosed},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(breakerState.WithLabelValues(tt.client, "shared")); got != float64(tt.want) {
+			t.Errorf("circuit_state of %s = %v, want %v", tt.client, got, float64(tt.want))
+		}
+	}
+}
@@ -19,21 +19,19 @@
 package http
 
 import (
+	"github.com/cauwulixuan/go-kit/log"
 	"github.com/go-resty/resty/v2"
 	"github.com/spf13/viper"
-	"net/http"
+	"go.uber.org/zap/zapcore"
 	"time"
 )
 
-// Retry strategies:
-//- No BackOff
-//- Linear BackOff
-//- LinearRandom BackOff
-//- Exponential Backoff
-//- ExponentialRandom BackOff
-
 var (
-	Client = resty.New()
+	// Client propagates the request ID and trace headers of the request contexts.
+	Client = resty.New().OnBeforeRequest(propagate)
+
+	// clientRetry holds the retry policy of Client, replaced by every SetRetry.
+	clientRetry retrySetting
 )
 
 func Init(retry bool) {
@@ -41,19 +39,170 @@ func Init(retry bool) {
 		SetRetry()
 	}
 	SetTimeout()
+	if err := SetTLS(); err != nil {
+		log.Slogger.Errorf("Setting TLS of the HTTP client failed, its requests fail until the TLS settings are fixed, error: %v", err)
+	}
+	if viper.GetFloat64("http.rate_limit.rps") > 0 {
+		SetRateLimit()
+	}
+	if viper.GetBool("http.metrics.enable") {
+		SetMetrics()
+	}
+	if viper.GetBool("http.breaker.enable") {
+		SetBreaker()
+	}
+	if viper.GetBool("http.logging.enable") {
+		SetLogging()
+	}
+	if viper.GetBool("http.tracing.enable") {
+		SetTracing()
+	}
 }
 
+// SetRetry retries failed requests as set by http.retries, waiting as http.retries.strategy between the attempts.
 func SetRetry() {
-	Client.
-		SetRetryCount(viper.GetInt("http.retries.max_num_of_attempts")).
-		SetRetryMaxWaitTime(time.Duration(viper.GetInt("http.retries.max_backoff_delay")) * time.Second).
-		AddRetryCondition(
-			func(response *resty.Response, err error) bool {
-				return err != nil || response.StatusCode() != http.StatusOK
-			},
-		)
+	setRetry(Client, section(""), &clientRetry)
 }
 
+// SetTimeout bounds every attempt of a request by http.timeout,
+// the deadline of the request context bounds all of them.
 func SetTimeout() {
-	Client.SetTimeout(time.Duration(viper.GetInt("http.timeout")) * time.Second)
+	Client.SetTimeout(section("").timeout())
+}
+
+// SetTLS makes Client use the TLS settings of http.tls, reloading the certificates once their files change.
+// It can be called again to apply changed settings, but must be called before SetMetrics, SetBreaker and SetTracing.
+// If the settings are invalid, the requests of Client fail with a *TLSSettingsError.
+func SetTLS() error {
+	return setTLS(Client, section(""))
+}
+
+// SetRateLimit limits the requests of Client per upstream host as set by http.rate_limit.
+func SetRateLimit() {
+	NewRateLimiter(section("").rateLimitConfig()).Apply(Client)
+}
+
+// SetMetrics records the requests of Client in the gokit_http_client metrics.
+func SetMetrics() {
+	Instrument(Client)
+}
+
+// SetBreaker fails the requests to an upstream host fast while it keeps failing, as set by http.breaker.
+// TLS settings of Client and SetMetrics must be made before.
+func SetBreaker() {
+	Client.SetTransport(NewBreakerTransport(section("").breakerConfig(), Client.GetClient().Transport))
+}
+
+// SetTracing starts a client span for every attempt of the requests of Client.
+// TLS settings of Client, SetMetrics and SetBreaker must be made before.
+func SetTracing() {
+	Trace(Client)
+}
+
+// SetLogging logs every attempt of the requests of Client as set by http.logging.
+func SetLogging() {
+	section("").requestLogger().Apply(Client)
+}
+
+// section reads the settings of the named client in http.clients,
+// falling back to the global http settings for the keys it does not set.
+type section string
+
+func (s section) key(key string) string {
+	if s != "" {
+		if k := "http.clients." + string(s) + "." + key; viper.IsSet(k) {
+			return k
+		}
+	}
+	return "http." + key
+}
+
+func (s section) timeout() time.Duration {
+	return time.Duration(viper.GetInt(s.key("timeout"))) * time.Second
+}
+
+// setRetry applies the retry settings of s to c, replacing the policy rs holds.
+func setRetry(c *resty.Client, s section, rs *retrySetting) {
+	b, err := NewBackoff(s.backoffConfig())
+	if err != nil {
+		log.Slogger.Errorf("Setting retry backoff failed, retrying without backoff, error: %v", err)
+		b, _ = NewBackoff(BackoffConfig{})
+	}
+	c.
+		SetRetryCount(viper.GetInt(s.key("retries.max_num_of_attempts"))).
+		SetRetryWaitTime(viper.GetDuration(s.key("retries.min_delay"))).
+		SetRetryMaxWaitTime(s.maxDelay())
+	rs.apply(c, s.retryPolicy(b))
+}
+
+func (s section) retryPolicy(b Backoff) *RetryPolicy {
+	p := &RetryPolicy{
+		Statuses:      viper.GetIntSlice(s.key("retries.statuses")),
+		NonIdempotent: viper.GetBool(s.key("retries.non_idempotent")),
+		MaxDelay:      s.maxDelay(),
+		Backoff:       b,
+	}
+	if len(p.Statuses) == 0 {
+		p.Statuses = DefaultRetryStatuses
+	}
+	if ratio := viper.GetFloat64(s.key("retries.budget_ratio")); ratio > 0 {
+		p.Budget = NewRetryBudget(ratio, viper.GetInt(s.key("retries.budget_min_per_second")))
+	}
+	return p
+}
+
+func (s section) backoffConfig() BackoffConfig {
+	return BackoffConfig{
+		Strategy:   viper.GetString(s.key("retries.strategy")),
+		MinDelay:   viper.GetDuration(s.key("retries.min_delay")),
+		MaxDelay:   s.maxDelay(),
+		Multiplier: viper.GetFloat64(s.key("retries.multiplier")),
+	}
+}
+
+// maxDelay returns retries.max_delay, or max_backoff_delay in seconds if it is not set.
+func (s section) maxDelay() time.Duration {
+	if k := s.key("retries.max_delay"); viper.IsSet(k) {
+		return viper.GetDuration(k)
+	}
+	return time.Duration(viper.GetInt(s.key("retries.max_backoff_delay"))) * time.Second
+}
+
+func (s section) breakerConfig() BreakerConfig {
+	return BreakerConfig{
+		Client:              string(s),
+		ConsecutiveFailures: viper.GetInt(s.key("breaker.consecutive_failures")),
+		FailureRate:         viper.GetFloat64(s.key("breaker.failure_rate")),
+		Window:              viper.GetDuration(s.key("breaker.window")),
+		MinRequests:         viper.GetInt(s.key("breaker.min_requests")),
+		OpenTimeout:         viper.GetDuration(s.key("breaker.open_timeout")),
+		HalfOpenRequests:    viper.GetInt(s.key("breaker.half_open_requests")),
+	}
+}
+
+func (s section) requestLogger() *RequestLogger {
+	l := &RequestLogger{
+		Client:        string(s),
+		Bodies:        viper.GetBool(s.key("logging.bodies")),
+		MaxBodySize:   viper.GetInt(s.key("logging.max_body_size")),
+		RedactHeaders: viper.GetStringSlice(s.key("logging.redact_headers")),
+		RedactFields:  viper.GetStringSlice(s.key("logging.redact_fields")),
+	}
+	if level := viper.GetString(s.key("logging.level")); level != "" {
+		var err error
+		if l.Level, err = zapcore.ParseLevel(level); err != nil {
+			log.Slogger.Errorf("Invalid HTTP logging level %s, logging at debug, error: %v", level, err)
+			l.Level = zapcore.DebugLevel
+		}
+	}
+	return l
+}
+
+func (s section) rateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		RPS:      viper.GetFloat64(s.key("rate_limit.rps")),
+		Burst:    viper.GetInt(s.key("rate_limit.burst")),
+		Adaptive: viper.GetBool(s.key("rate_limit.adaptive")),
+		MinRPS:   viper.GetFloat64(s.key("rate_limit.min_rps")),
+	}
 }
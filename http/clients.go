@@ -0,0 +1,188 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/cauwulixuan/go-kit/log"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/viper"
+)
+
+// namedClient is a client built from its config section, fingerprint is the config it was built from.
+// A client whose tls settings are invalid is kept until its config or its tls files change, tlsStamp are the files it was built from.
+type namedClient struct {
+	client      *resty.Client
+	fingerprint string
+	failed      bool
+	tlsStamp    string
+}
+
+var (
+	// clientsMu guards clients, buildMu serializes the builds so that clientsMu is not held while building.
+	clientsMu sync.Mutex
+	clients   = make(map[string]*namedClient)
+	buildMu   sync.Mutex
+
+	clientHooksMu sync.RWMutex
+	clientHooks   []ClientHook
+)
+
+func init() {
+	// the log collector ships its batches with the timeout, retries and TLS settings of http.clients.collector.
+	log.SetCollectorClient(func() *resty.Client { return ClientFor("collector") })
+}
+
+// ClientHook configures a client built by ClientFor, name is its name in http.clients.
+// It must not call ClientFor.
+type ClientHook func(name string, c *resty.Client)
+
+// RegisterClientHook runs h for the clients ClientFor built so far,
+// and for every client it builds from then on, the rebuilt ones included.
+func RegisterClientHook(h ClientHook) {
+	// the builds wait meanwhile, so that no client is missed or hooked twice.
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	clientHooksMu.Lock()
+	clientHooks = append(clientHooks, h)
+	clientHooksMu.Unlock()
+
+	clientsMu.Lock()
+	built := make(map[string]*resty.Client, len(clients))
+	for name, nc := range clients {
+		built[name] = nc.client
+	}
+	clientsMu.Unlock()
+	for name, c := range built {
+		h(name, c)
+	}
+}
+
+// ClientFor returns the client configured by http.clients.<name>, with its base_url, headers, timeout,
+// retries, rate_limit, breaker, logging, metrics, tracing and tls. Unset settings fall back to the global http section.
+// The client is built on first use and rebuilt once its config changes, or its tls files if they failed it.
+func ClientFor(name string) *resty.Client {
+	s := section(name)
+	fingerprint := s.fingerprint()
+	if c, ok := cachedClient(name, fingerprint); ok {
+		return c
+	}
+
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	// another call may have built it meanwhile.
+	if c, ok := cachedClient(name, fingerprint); ok {
+		return c
+	}
+	clientsMu.Lock()
+	prev := clients[name]
+	clientsMu.Unlock()
+
+	if !viper.IsSet("http.clients." + name) {
+		log.Slogger.Warnf("HTTP client %s is not configured in http.clients, using the global http settings", name)
+	}
+	// stamped before building, so that files changed meanwhile are read again.
+	stamp := s.tlsStamp()
+	c, err := newClient(s)
+	if err != nil {
+		if prev != nil && !prev.failed {
+			log.Slogger.Errorf("Rebuilding HTTP client %s failed, keeping the previous one, error: %v", name, err)
+			return prev.client
+		}
+		log.Slogger.Errorf("Building HTTP client %s failed, its requests fail until the TLS settings are fixed, error: %v", name, err)
+	}
+	clientHooksMu.RLock()
+	for _, h := range clientHooks {
+		h(name, c)
+	}
+	clientHooksMu.RUnlock()
+	if prev != nil {
+		prev.client.GetClient().CloseIdleConnections()
+	}
+	clientsMu.Lock()
+	clients[name] = &namedClient{client: c, fingerprint: fingerprint, failed: err != nil, tlsStamp: stamp}
+	clientsMu.Unlock()
+	return c
+}
+
+// cachedClient returns the client of name if it is built from fingerprint, and from the current tls files if they failed it.
+func cachedClient(name, fingerprint string) (*resty.Client, bool) {
+	clientsMu.Lock()
+	nc, ok := clients[name]
+	clientsMu.Unlock()
+	if !ok || nc.fingerprint != fingerprint {
+		return nil, false
+	}
+	if nc.failed && nc.tlsStamp != section(name).tlsStamp() {
+		return nil, false
+	}
+	return nc.client, true
+}
+
+// fingerprint encodes the settings a client of s is built from.
+func (s section) fingerprint() string {
+	b, _ := json.Marshal([]interface{}{
+		viper.Get("http.clients." + string(s)),
+		viper.Get("http.timeout"),
+		viper.Get("http.retries"),
+		viper.Get("http.tls"),
+		viper.Get("http.breaker"),
+		viper.Get("http.logging"),
+		viper.Get("http.metrics"),
+		viper.Get("http.tracing"),
+		viper.Get("http.rate_limit"),
+	})
+	return string(b)
+}
+
+// newClient builds the client of s, its requests fail with a *TLSSettingsError if the TLS settings are invalid.
+// The circuit breakers of a client are per upstream host and start closed whenever it is rebuilt.
+func newClient(s section) (*resty.Client, error) {
+	c := resty.New().OnBeforeRequest(propagate)
+	if s != "" {
+		prefix := "http.clients." + string(s) + "."
+		c.SetBaseURL(viper.GetString(prefix + "base_url"))
+		c.SetHeaders(viper.GetStringMapString(prefix + "headers"))
+	}
+	c.SetTimeout(s.timeout())
+	if viper.GetBool(s.key("retries.enable")) {
+		setRetry(c, s, new(retrySetting))
+	}
+	if cfg := s.rateLimitConfig(); cfg.RPS > 0 {
+		NewRateLimiter(cfg).Apply(c)
+	}
+	if viper.GetBool(s.key("logging.enable")) {
+		s.requestLogger().Apply(c)
+	}
+
+	err := setTLS(c, s)
+	// they wrap the transport, so they come after the TLS settings,
+	// the spans are outermost to show the requests failed fast by the breaker.
+	if viper.GetBool(s.key("metrics.enable")) {
+		Instrument(c)
+	}
+	if viper.GetBool(s.key("breaker.enable")) {
+		c.SetTransport(NewBreakerTransport(s.breakerConfig(), c.GetClient().Transport))
+	}
+	if viper.GetBool(s.key("tracing.enable")) {
+		Trace(c)
+	}
+	return c, err
+}
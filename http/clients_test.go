@@ -0,0 +1,92 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/log/logtest"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/viper"
+)
+
+func TestClientFor(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("http.timeout", 30)
+	viper.Set("http.clients.upstream", map[string]interface{}{
+		"base_url": "http://upstream.local",
+		"headers":  map[string]interface{}{"X-Caller": "go-kit"},
+	})
+
+	c := ClientFor("upstream")
+	if c.BaseURL != "http://upstream.local" {
+		t.Errorf("BaseURL = %v, want http://upstream.local", c.BaseURL)
+	}
+	if got := c.Header.Get("X-Caller"); got != "go-kit" {
+		t.Errorf("header X-Caller = %v, want go-kit", got)
+	}
+	if got := c.GetClient().Timeout; got != 30*time.Second {
+		t.Errorf("timeout = %v, want the global 30s", got)
+	}
+	if ClientFor("upstream") != c {
+		t.Errorf("ClientFor() built a new client for the same config")
+	}
+
+	viper.Set("http.clients.upstream.timeout", 5)
+	rebuilt := ClientFor("upstream")
+	if rebuilt == c {
+		t.Fatalf("ClientFor() kept the client after its config changed")
+	}
+	if got := rebuilt.GetClient().Timeout; got != 5*time.Second {
+		t.Errorf("timeout = %v, want 5s", got)
+	}
+}
+
+func TestRegisterClientHook(t *testing.T) {
+	logtest.New(t)
+	defer viper.Reset()
+	prev := clientHooks
+	defer func() {
+		clientHooks = prev
+		clientsMu.Lock()
+		delete(clients, "hooked")
+		delete(clients, "hooked_early")
+		clientsMu.Unlock()
+	}()
+
+	// built before the hook is registered.
+	early := ClientFor("hooked_early")
+	hooked := make(map[string]int)
+	RegisterClientHook(func(name string, c *resty.Client) {
+		hooked[name]++
+		c.SetHeader("X-Hooked", "1")
+	})
+	viper.Set("http.clients.hooked.base_url", "http://hooked.local")
+	for _, c := range []*resty.Client{early, ClientFor("hooked")} {
+		if c.Header.Get("X-Hooked") != "1" {
+			t.Errorf("header X-Hooked = %v, want it set by the hook", c.Header.Get("X-Hooked"))
+		}
+	}
+	ClientFor("hooked")
+	viper.Set("http.clients.hooked.timeout", 5)
+	ClientFor("hooked")
+	if hooked["hooked"] != 2 || hooked["hooked_early"] != 1 {
+		t.Errorf("hooked %v, want the early client once and the built and the rebuilt client", hooked)
+	}
+}
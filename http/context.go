@@ -0,0 +1,92 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying the request ID id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestIDFrom returns the request ID of ctx, "" if it has none.
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random request ID.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestIDHandler puts the X-Request-Id of inbound requests, or a new one, into their context
+// and the response, so that the outbound requests made with that context carry it on.
+func RequestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" {
+			id = NewRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// Propagator copies values of ctx into the headers of an outbound request.
+type Propagator func(ctx context.Context, h http.Header)
+
+var (
+	propagatorsMu sync.RWMutex
+	propagators   = []Propagator{propagateRequestID, propagateTrace}
+)
+
+// RegisterPropagator adds p to the propagators run for every request of the kit's clients.
+func RegisterPropagator(p Propagator) {
+	propagatorsMu.Lock()
+	defer propagatorsMu.Unlock()
+	propagators = append(propagators, p)
+}
+
+func propagateRequestID(ctx context.Context, h http.Header) {
+	if id := RequestIDFrom(ctx); id != "" && h.Get(RequestIDHeader) == "" {
+		h.Set(RequestIDHeader, id)
+	}
+}
+
+// propagate is a resty request middleware running the propagators with the request context.
+func propagate(_ *resty.Client, r *resty.Request) error {
+	propagatorsMu.RLock()
+	defer propagatorsMu.RUnlock()
+	for _, p := range propagators {
+		p(r.Context(), r.Header)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get(RequestIDHeader)))
+	}))
+	defer upstream.Close()
+
+	c := resty.New().OnBeforeRequest(propagate)
+	srv := httptest.NewServer(RequestIDHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := c.R().SetContext(r.Context()).Get(upstream.URL)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write(resp.Body())
+	})))
+	defer srv.Close()
+
+	resp, err := resty.New().R().SetHeader(RequestIDHeader, "req-1").Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.String() != "req-1" || resp.Header().Get(RequestIDHeader) != "req-1" {
+		t.Errorf("upstream got request id %q, response has %q, want req-1", resp.String(), resp.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestRetryStopsAtDeadline(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	b, _ := NewBackoff(BackoffConfig{MinDelay: 200 * time.Millisecond})
+	c := resty.New().SetRetryCount(3).SetRetryWaitTime(200 * time.Millisecond)
+	(&RetryPolicy{Statuses: DefaultRetryStatuses, Backoff: b}).Apply(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := c.R().SetContext(ctx).Get(srv.URL); err == nil {
+		t.Errorf("Get() succeeded, want the deadline error")
+	}
+	if calls != 1 {
+		t.Errorf("calls = %v, want 1", calls)
+	}
+	if took := time.Since(start); took > 100*time.Millisecond {
+		t.Errorf("Get() took %v, want to give up before the deadline", took)
+	}
+}
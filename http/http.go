@@ -19,22 +19,39 @@
 package http
 
 import (
+	"context"
+	"errors"
 	"github.com/cauwulixuan/go-kit/log"
 	"net/http"
 )
 
 //GetUrl Get data from a given url.
+//
+// Deprecated: use GetUrlContext, which can be canceled and tells failures apart.
 func GetUrl(url string) string {
-	resp, err := Client.R().Get(url)
-	if err != nil {
+	body, err := GetUrlContext(context.Background(), url)
+	var e *Error
+	switch {
+	case err == nil:
+		return body
+	case errors.As(err, &e) && e.StatusCode != 0:
+		log.SInfof("Status code is %d not 200 while getting url %s", e.StatusCode, url)
+	default:
 		log.SErrorf("Error happend while get url %s, error message: %v", url, err.Error())
-		return ""
 	}
+	return ""
+}
 
-	if resp.StatusCode() == http.StatusOK {
-		return resp.String()
-	} else {
-		log.SInfof("Status code is %d not 200 while getting url %s", resp.StatusCode(), url)
-		return ""
+// GetUrlContext gets url with Client within ctx and returns the body of a 200 response.
+// Other responses are returned as an *Error.
+func GetUrlContext(ctx context.Context, url string) (string, error) {
+	req := Client.R()
+	resp, err := req.SetContext(ctx).Get(url)
+	if err != nil {
+		return "", newError(req, resp, err)
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return "", newError(req, resp, nil)
 	}
+	return resp.String(), nil
 }
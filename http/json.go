@@ -0,0 +1,171 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/cauwulixuan/go-kit/errors"
+	"github.com/go-resty/resty/v2"
+)
+
+// RequestIDHeader identifies a request in the logs of both sides.
+const RequestIDHeader = "X-Request-Id"
+
+// maxBodyExcerpt bounds the response body kept in an Error.
+const maxBodyExcerpt = 512
+
+// Error is returned by the JSON helpers for a request which failed or got an error status.
+type Error struct {
+	Method string
+	URL    string
+	// StatusCode is 0 if no response was received.
+	StatusCode int
+	// Body is the beginning of the response body.
+	Body string
+	// RequestID is the X-Request-Id of the response, or of the request.
+	RequestID string
+	// Retries counts the attempts after the first one.
+	Retries int
+	// Problem is the decoded application/problem+json body, if any.
+	Problem *errors.Problem
+	// Err is the transport or decoding error, if any.
+	Err error
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s: ", e.Method, e.URL)
+	switch {
+	case e.Err != nil && e.StatusCode == 0:
+		b.WriteString(e.Err.Error())
+	default:
+		fmt.Fprintf(&b, "%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+		if e.Problem != nil && e.Problem.Detail != "" {
+			b.WriteString(": " + e.Problem.Detail)
+		} else if e.Problem != nil && e.Problem.Title != "" {
+			b.WriteString(": " + e.Problem.Title)
+		} else if e.Body != "" {
+			b.WriteString(": " + e.Body)
+		}
+		if e.Err != nil {
+			b.WriteString(": " + e.Err.Error())
+		}
+	}
+	if e.RequestID != "" {
+		fmt.Fprintf(&b, " (request id %s)", e.RequestID)
+	}
+	if e.Retries > 0 {
+		fmt.Fprintf(&b, " after %d retries", e.Retries)
+	}
+	return b.String()
+}
+
+// Unwrap returns the transport or decoding error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Code returns the code of the problem body, or the one of the status.
+func (e *Error) Code() errors.Code {
+	if e.Problem != nil && e.Problem.Code != "" {
+		return e.Problem.Code
+	}
+	if e.StatusCode == 0 {
+		return errors.Unavailable
+	}
+	if code := errors.CodeOfStatus(e.StatusCode); code != "" {
+		return code
+	}
+	// a successful response which could not be decoded.
+	return errors.Internal
+}
+
+// GetJSON gets url with c and decodes the JSON response into a T.
+func GetJSON[T any](ctx context.Context, c *resty.Client, url string) (T, error) {
+	return Do[T](ctx, c.R(), http.MethodGet, url)
+}
+
+// PostJSON posts body as JSON to url with c and decodes the JSON response into a Resp.
+func PostJSON[Req, Resp any](ctx context.Context, c *resty.Client, url string, body Req) (Resp, error) {
+	return Do[Resp](ctx, c.R().SetHeader("Content-Type", "application/json").SetBody(body), http.MethodPost, url)
+}
+
+// Do sends req and decodes the JSON response into a T, the zero T for an empty body.
+// Failures and error statuses are returned as an *Error.
+func Do[T any](ctx context.Context, req *resty.Request, method, url string) (T, error) {
+	var result T
+	if req.Header.Get("Accept") == "" {
+		req.SetHeader("Accept", "application/json, "+errors.ProblemContentType)
+	}
+	resp, err := req.SetContext(ctx).Execute(method, url)
+	if err != nil {
+		return result, newError(req, resp, err)
+	}
+	if resp.IsError() {
+		return result, newError(req, resp, nil)
+	}
+	if len(resp.Body()) == 0 {
+		return result, nil
+	}
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return result, newError(req, resp, fmt.Errorf("decode response: %w", err))
+	}
+	return result, nil
+}
+
+func newError(req *resty.Request, resp *resty.Response, err error) *Error {
+	e := &Error{
+		Method:    req.Method,
+		URL:       req.URL,
+		RequestID: req.Header.Get(RequestIDHeader),
+		Retries:   req.Attempt - 1,
+		Err:       err,
+	}
+	if e.Retries < 0 {
+		e.Retries = 0
+	}
+	if resp == nil || resp.RawResponse == nil {
+		return e
+	}
+
+	e.StatusCode = resp.StatusCode()
+	if id := resp.Header().Get(RequestIDHeader); id != "" {
+		e.RequestID = id
+	}
+	body := resp.Body()
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header().Get("Content-Type")); mediaType == errors.ProblemContentType {
+		var p errors.Problem
+		if json.Unmarshal(body, &p) == nil {
+			e.Problem = &p
+		}
+	}
+	e.Body = excerpt(body)
+	return e
+}
+
+// excerpt returns the beginning of body, cut at a rune boundary.
+func excerpt(body []byte) string {
+	return truncate(bytes.TrimSpace(body), maxBodyExcerpt)
+}
@@ -0,0 +1,112 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cauwulixuan/go-kit/errors"
+	"github.com/go-resty/resty/v2"
+)
+
+type user struct {
+	Name string `json:"name"`
+}
+
+func TestGetJSON(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"x"}`))
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(RequestIDHeader, "req-1")
+		errors.WriteHTTP(w, errors.New(errors.NotFound, "user x not found"))
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte("upstream down"))
+	})
+	mux.HandleFunc("/invalid", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html>"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path       string
+		want       user
+		wantCode   errors.Code
+		wantStatus int
+		wantErr    string
+	}{
+		{"/ok", user{Name: "x"}, "", 0, ""},
+		{"/empty", user{}, "", 0, ""},
+		{"/missing", user{}, errors.NotFound, http.StatusNotFound,
+			"GET " + srv.URL + "/missing: 404 Not Found: user x not found (request id req-1)"},
+		{"/broken", user{}, errors.Unavailable, http.StatusBadGateway, "GET " + srv.URL + "/broken: 502 Bad Gateway: upstream down"},
+		{"/invalid", user{}, errors.Internal, http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := GetJSON[user](context.Background(), resty.New(), srv.URL+tt.path)
+			if got != tt.want {
+				t.Errorf("GetJSON() = %v, want %v", got, tt.want)
+			}
+			if (err != nil) != (tt.wantCode != "") {
+				t.Fatalf("GetJSON() error = %v, want code %v", err, tt.wantCode)
+			}
+			if err == nil {
+				return
+			}
+			var e *Error
+			if !stderrors.As(err, &e) || e.StatusCode != tt.wantStatus {
+				t.Errorf("GetJSON() error = %#v, want status %v", err, tt.wantStatus)
+			}
+			if code := errors.CodeOf(err); code != tt.wantCode {
+				t.Errorf("CodeOf() = %v, want %v", code, tt.wantCode)
+			}
+			if tt.wantErr != "" && err.Error() != tt.wantErr {
+				t.Errorf("Error() = %v, want %v", err.Error(), tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPostJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"created"}`))
+	}))
+	defer srv.Close()
+
+	got, err := PostJSON[user, user](context.Background(), resty.New(), srv.URL, user{Name: "x"})
+	if err != nil || got.Name != "created" {
+		t.Errorf("PostJSON() = %v, %v, want created", got, err)
+	}
+}
@@ -0,0 +1,309 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cauwulixuan/go-kit/log"
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Redacted replaces the logged values of redacted headers, fields and query parameters.
+const Redacted = "[REDACTED]"
+
+// DefaultRedactHeaders are always redacted by a RequestLogger.
+var DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// DefaultRedactFields are always redacted by a RequestLogger, they carry the client credentials of OAuth2 token requests.
+var DefaultRedactFields = []string{"client_secret", "client_assertion"}
+
+// RequestLogger logs every attempt of the requests of a client through the kit's logger,
+// with its method, URL, status, duration, attempt number and sizes.
+type RequestLogger struct {
+	// Client names the client in the entries, "" does not.
+	Client string
+	// Level of the entries, failed attempts are logged at WARN at least.
+	Level zapcore.Level
+	// Bodies adds the headers and the bodies to the entries while DEBUG is enabled.
+	Bodies bool
+	// MaxBodySize bounds the logged bodies, 0 does not.
+	MaxBodySize int
+	// RedactHeaders are redacted besides DefaultRedactHeaders.
+	RedactHeaders []string
+	// RedactFields are redacted besides DefaultRedactFields in JSON and form bodies, at any depth,
+	// and in the query, case-insensitively.
+	RedactFields []string
+
+	// failed are the attempts which failed without a response and are logged already, by request.
+	failed sync.Map
+}
+
+// Apply installs l on c.
+func (l *RequestLogger) Apply(c *resty.Client) {
+	c.OnAfterResponse(func(_ *resty.Client, resp *resty.Response) error {
+		l.failed.Delete(resp.Request)
+		l.logResponse(resp)
+		return nil
+	})
+	// failed attempts are retried without a response.
+	c.AddRetryHook(func(resp *resty.Response, err error) {
+		if err != nil && resp != nil && resp.RawResponse == nil {
+			l.logError(resp.Request, err)
+			l.failed.Store(resp.Request, resp.Request.Attempt)
+		}
+	})
+	c.OnError(func(r *resty.Request, err error) {
+		var respErr *resty.ResponseError
+		if errors.As(err, &respErr) {
+			if respErr.Response.RawResponse != nil {
+				// logged by OnAfterResponse.
+				return
+			}
+			err = respErr.Err
+		}
+		if attempt, ok := l.failed.LoadAndDelete(r); ok && attempt == r.Attempt {
+			return
+		}
+		l.logError(r, err)
+	})
+}
+
+func (l *RequestLogger) fields(r *resty.Request) []zap.Field {
+	fields := make([]zap.Field, 0, 12)
+	if l.Client != "" {
+		fields = append(fields, zap.String("client", l.Client))
+	}
+	fields = append(fields, zap.String("method", r.Method), zap.String("url", l.redactURL(r)), zap.Int("attempt", r.Attempt))
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		fields = append(fields, zap.String("request_id", id))
+	}
+	if r.RawRequest != nil && r.RawRequest.ContentLength > 0 {
+		fields = append(fields, zap.Int64("request_size", r.RawRequest.ContentLength))
+	}
+	return fields
+}
+
+func (l *RequestLogger) logResponse(resp *resty.Response) {
+	fields := append(l.fields(resp.Request),
+		zap.Int("status", resp.StatusCode()),
+		zap.Duration("duration", resp.Time()),
+		zap.Int64("response_size", resp.Size()))
+	if l.bodiesEnabled() {
+		fields = append(fields,
+			zap.Object("request_headers", l.headers(requestHeader(resp.Request))),
+			zap.String("request_body", l.body(requestBody(resp.Request), requestHeader(resp.Request))),
+			zap.Object("response_headers", l.headers(resp.Header())),
+			zap.String("response_body", l.body(resp.Body(), resp.Header())))
+	}
+	level := l.Level
+	if resp.StatusCode() >= http.StatusInternalServerError && level < zapcore.WarnLevel {
+		level = zapcore.WarnLevel
+	}
+	write(level, "HTTP request", fields)
+}
+
+func (l *RequestLogger) logError(r *resty.Request, err error) {
+	fields := append(l.fields(r), zap.Error(err))
+	if !r.Time.IsZero() {
+		fields = append(fields, zap.Duration("duration", time.Since(r.Time)))
+	}
+	if l.bodiesEnabled() {
+		fields = append(fields,
+			zap.Object("request_headers", l.headers(requestHeader(r))),
+			zap.String("request_body", l.body(requestBody(r), requestHeader(r))))
+	}
+	level := l.Level
+	if level < zapcore.WarnLevel {
+		level = zapcore.WarnLevel
+	}
+	write(level, "HTTP request failed", fields)
+}
+
+func write(level zapcore.Level, msg string, fields []zap.Field) {
+	switch level {
+	case zapcore.DebugLevel:
+		log.Debug(msg, fields...)
+	case zapcore.InfoLevel:
+		log.Info(msg, fields...)
+	case zapcore.WarnLevel:
+		log.Warn(msg, fields...)
+	default:
+		log.Error(msg, fields...)
+	}
+}
+
+func (l *RequestLogger) bodiesEnabled() bool {
+	return l.Bodies && zap.L().Core().Enabled(zapcore.DebugLevel)
+}
+
+func (l *RequestLogger) redactHeader(name string) bool {
+	for _, h := range DefaultRedactHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	for _, h := range l.RedactHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *RequestLogger) redactField(name string) bool {
+	for _, f := range DefaultRedactFields {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	for _, f := range l.RedactFields {
+		if strings.EqualFold(f, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// headers returns h with the redacted headers replaced.
+func (l *RequestLogger) headers(h http.Header) zapcore.ObjectMarshaler {
+	return zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		for name, values := range h {
+			if l.redactHeader(name) {
+				enc.AddString(name, Redacted)
+				continue
+			}
+			enc.AddString(name, strings.Join(values, ", "))
+		}
+		return nil
+	})
+}
+
+// redactURL returns the URL of r without its password and with the redacted query parameters replaced.
+func (l *RequestLogger) redactURL(r *resty.Request) string {
+	if r.RawRequest == nil || r.RawRequest.URL == nil {
+		return r.URL
+	}
+	u := *r.RawRequest.URL
+	if u.RawQuery != "" {
+		u.RawQuery = l.redactValues(u.Query()).Encode()
+	}
+	return u.Redacted()
+}
+
+func (l *RequestLogger) redactValues(values url.Values) url.Values {
+	for name := range values {
+		if l.redactField(name) {
+			values[name] = []string{Redacted}
+		}
+	}
+	return values
+}
+
+// body redacts and truncates a JSON or form body, other bodies are only truncated.
+func (l *RequestLogger) body(b []byte, h http.Header) string {
+	if len(b) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var v interface{}
+		if json.Unmarshal(b, &v) == nil {
+			if redacted, err := json.Marshal(l.redactJSON(v)); err == nil {
+				b = redacted
+			}
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(string(b)); err == nil {
+			b = []byte(l.redactValues(values).Encode())
+		}
+	}
+	return truncate(b, l.MaxBodySize)
+}
+
+func (l *RequestLogger) redactJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if l.redactField(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = l.redactJSON(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = l.redactJSON(value)
+		}
+	}
+	return v
+}
+
+func requestHeader(r *resty.Request) http.Header {
+	if r.RawRequest != nil {
+		return r.RawRequest.Header
+	}
+	return r.Header
+}
+
+// requestBody returns the body of r as it was set, streams are not read.
+func requestBody(r *resty.Request) []byte {
+	switch b := r.Body.(type) {
+	case nil:
+		if len(r.FormData) > 0 {
+			return []byte(r.FormData.Encode())
+		}
+		return nil
+	case []byte:
+		return b
+	case string:
+		return []byte(b)
+	case io.Reader:
+		return []byte("<stream>")
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			return nil
+		}
+		return encoded
+	}
+}
+
+// truncate returns the first max bytes of b cut at a rune boundary, all of it if max is 0.
+func truncate(b []byte, max int) string {
+	if max <= 0 || len(b) <= max {
+		return string(b)
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(b[cut]) {
+		cut--
+	}
+	return string(b[:cut]) + "..."
+}
@@ -0,0 +1,140 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/log/logtest"
+	"github.com/go-resty/resty/v2"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRequestLoggerRedaction(t *testing.T) {
+	logs := logtest.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Set-Cookie", "session=s1")
+		w.Write([]byte(`{"user":"u1","access":[{"Token":"t2"}]}`))
+	}))
+	defer srv.Close()
+
+	c := resty.New()
+	(&RequestLogger{Client: "test", Level: zapcore.InfoLevel, Bodies: true, RedactHeaders: []string{"X-Api-Key"},
+		RedactFields: []string{"password", "token"}}).Apply(c)
+	_, err := c.R().
+		SetHeader("Authorization", "Bearer t0").
+		SetHeader("X-Api-Key", "k1").
+		SetBody(map[string]interface{}{"user": "u1", "password": "p1"}).
+		Post(srv.URL + "/login?token=t1&page=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := logs.Filter(zapcore.InfoLevel, "HTTP request")
+	if len(entries) != 1 {
+		t.Fatalf("logged %v, want an HTTP request entry", logs)
+	}
+	fields := entries[0].ContextMap()
+	for key, want := range map[string]interface{}{
+		"client":        "test",
+		"method":        http.MethodPost,
+		"url":           srv.URL + "/login?page=2&token=%5BREDACTED%5D",
+		"status":        int64(http.StatusOK),
+		"attempt":       int64(1),
+		"request_body":  `{"password":"[REDACTED]","user":"u1"}`,
+		"response_body": `{"access":[{"Token":"[REDACTED]"}],"user":"u1"}`,
+	} {
+		if fields[key] != want {
+			t.Errorf("%s = %v, want %v", key, fields[key], want)
+		}
+	}
+	requestHeaders, _ := fields["request_headers"].(map[string]interface{})
+	for _, name := range []string{"Authorization", "X-Api-Key"} {
+		if requestHeaders[name] != Redacted {
+			t.Errorf("request header %s = %v, want it redacted", name, requestHeaders[name])
+		}
+	}
+	if responseHeaders, _ := fields["response_headers"].(map[string]interface{}); responseHeaders["Set-Cookie"] != Redacted {
+		t.Errorf("response header Set-Cookie = %v, want it redacted", responseHeaders["Set-Cookie"])
+	}
+	if logged := logs.String(); strings.Contains(logged, "t0") || strings.Contains(logged, "p1") || strings.Contains(logged, "t2") {
+		t.Errorf("logged a redacted value: %s", logged)
+	}
+}
+
+func TestRequestLoggerAttempts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	down := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	down.Close()
+	defer srv.Close()
+
+	tests := []struct {
+		name  string
+		url   string
+		level zapcore.Level
+		msg   string
+	}{
+		{"ErrorStatus", srv.URL, zapcore.WarnLevel, "HTTP request"},
+		{"NetworkError", down.URL, zapcore.WarnLevel, "HTTP request failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := logtest.New(t)
+			b, _ := NewBackoff(BackoffConfig{Strategy: StrategyNone, MinDelay: time.Millisecond})
+			c := resty.New().SetRetryCount(2).SetRetryWaitTime(time.Millisecond)
+			(&RetryPolicy{Statuses: DefaultRetryStatuses, Backoff: b}).Apply(c)
+			(&RequestLogger{Level: zapcore.DebugLevel}).Apply(c)
+			c.R().Get(tt.url)
+
+			entries := logs.Filter(tt.level, tt.msg)
+			if len(entries) != 3 {
+				t.Fatalf("logged %v, want an entry per attempt", logs)
+			}
+			for i, e := range entries {
+				if got := e.ContextMap()["attempt"]; got != int64(i+1) {
+					t.Errorf("attempt = %v, want %v", got, i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		body string
+		max  int
+		want string
+	}{
+		{"hello", 0, "hello"},
+		{"hello", 5, "hello"},
+		{"hello", 3, "hel..."},
+		{"héllo", 2, "h..."},
+	}
+	for _, tt := range tests {
+		if got := truncate([]byte(tt.body), tt.max); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.body, tt.max, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/metrics"
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	clientRequests = metrics.Factory().NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "http_client",
+		Name:      "requests_total",
+		Help:      "Number of attempts of outbound requests, by method, host and status class.",
+	}, []string{"method", "host", "status"})
+	clientDuration = metrics.Factory().NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "http_client",
+		Name:      "request_duration_seconds",
+		Help:      "Time until the response headers of the attempts of outbound requests, by method, host and status class.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "host", "status"})
+	clientInFlight = metrics.Factory().NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "http_client",
+		Name:      "in_flight_requests",
+		Help:      "Number of outbound requests waiting for the response headers, by method and host.",
+	}, []string{"method", "host"})
+	clientRetries = metrics.Factory().NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "http_client",
+		Name:      "retries_total",
+		Help:      "Number of retries of outbound requests, by method and host.",
+	}, []string{"method", "host"})
+)
+
+// MetricsHandler serves the kit's metrics, the HTTP client ones included, in Prometheus text format.
+func MetricsHandler() http.Handler {
+	return metrics.Handler()
+}
+
+// Instrument records the requests of c in the gokit_http_client metrics.
+// It wraps the transport of c, so it comes after the TLS settings and before SetBreaker,
+// leaving the requests failed fast by an open circuit out.
+func Instrument(c *resty.Client) {
+	c.SetTransport(&metricsTransport{next: c.GetClient().Transport})
+	c.OnBeforeRequest(func(c *resty.Client, r *resty.Request) error {
+		if r.Attempt > 1 {
+			clientRetries.WithLabelValues(methodLabel(r.Method), hostLabel(HostOf(c, r))).Inc()
+		}
+		return nil
+	})
+}
+
+// metricsTransport is a http.RoundTripper recording every attempt.
+type metricsTransport struct {
+	next http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	method, host := methodLabel(r.Method), hostLabel(r.URL.Host)
+	inFlight := clientInFlight.WithLabelValues(method, host)
+	inFlight.Inc()
+	start := time.Now()
+	resp, err := next.RoundTrip(r)
+	inFlight.Dec()
+
+	status := "error"
+	if err == nil {
+		status = statusClass(resp.StatusCode)
+	}
+	clientRequests.WithLabelValues(method, host, status).Inc()
+	clientDuration.WithLabelValues(method, host, status).Observe(time.Since(start).Seconds())
+	return resp, err
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (t *metricsTransport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// statusClass returns 1xx to 5xx, the status itself is not a label.
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// methodLabel returns method if it is a standard one, OTHER otherwise.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	case "":
+		return http.MethodGet
+	}
+	return "OTHER"
+}
+
+// maxHostLabels bounds the hosts labelled by name, the later ones are labelled other.
+const maxHostLabels = 100
+
+var (
+	hostLabelsMu sync.Mutex
+	hostLabels   = make(map[string]bool)
+)
+
+// hostLabel returns host while less than maxHostLabels hosts were seen, other afterwards.
+// Paths and queries are never labels.
+func hostLabel(host string) string {
+	if host == "" {
+		return "unknown"
+	}
+	hostLabelsMu.Lock()
+	defer hostLabelsMu.Unlock()
+	if hostLabels[host] {
+		return host
+	}
+	if len(hostLabels) >= maxHostLabels {
+		return "other"
+	}
+	hostLabels[host] = true
+	return host
+}
+
+// HostOf returns the host the request r of c is sent to, its base URL is used for a relative URL.
+func HostOf(c *resty.Client, r *resty.Request) string {
+	if r.RawRequest != nil && r.RawRequest.URL != nil {
+		return r.RawRequest.URL.Host
+	}
+	if u, err := url.Parse(r.URL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	if u, err := url.Parse(c.BaseURL); err == nil {
+		return u.Host
+	}
+	return ""
+}
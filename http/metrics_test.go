@@ -0,0 +1,105 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrument(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	b, _ := NewBackoff(BackoffConfig{Strategy: StrategyNone, MinDelay: time.Millisecond})
+	c := resty.New().SetBaseURL(srv.URL).SetRetryCount(2).SetRetryWaitTime(time.Millisecond)
+	(&RetryPolicy{Statuses: DefaultRetryStatuses, Backoff: b}).Apply(c)
+	Instrument(c)
+	if _, err := c.R().Get("/items/1?page=2"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{"requests 5xx", testutil.ToFloat64(clientRequests.WithLabelValues("GET", u.Host, "5xx")), 1},
+		{"requests 2xx", testutil.ToFloat64(clientRequests.WithLabelValues("GET", u.Host, "2xx")), 1},
+		{"retries", testutil.ToFloat64(clientRetries.WithLabelValues("GET", u.Host)), 1},
+		{"in flight", testutil.ToFloat64(clientInFlight.WithLabelValues("GET", u.Host)), 0},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestHostLabel(t *testing.T) {
+	prev := hostLabels
+	hostLabels = make(map[string]bool)
+	defer func() { hostLabels = prev }()
+
+	for i := 0; i < maxHostLabels; i++ {
+		hostLabel(fmt.Sprintf("host-%d:80", i))
+	}
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"host-0:80", "host-0:80"},
+		{"host-new:80", "other"},
+		{"", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := hostLabel(tt.host); got != tt.want {
+			t.Errorf("hostLabel(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestStatusClass(t *testing.T) {
+	tests := []struct {
+		status int
+		want   string
+	}{
+		{http.StatusOK, "2xx"},
+		{http.StatusNotFound, "4xx"},
+		{http.StatusGatewayTimeout, "5xx"},
+		{0, "unknown"},
+	}
+	for _, tt := range tests {
+		if got := statusClass(tt.status); got != tt.want {
+			t.Errorf("statusClass(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
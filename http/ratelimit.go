@@ -0,0 +1,142 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+
+	"github.com/cauwulixuan/go-kit/errors"
+	"github.com/cauwulixuan/go-kit/log"
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/time/rate"
+)
+
+// RateLimitConfig sets the token bucket of every upstream host.
+type RateLimitConfig struct {
+	// RPS is the sustained requests per second, 0 does not limit.
+	RPS float64
+	// Burst is the size of the bucket, RPS rounded up if 0.
+	Burst int
+	// Adaptive halves the rate on every 429 response, down to MinRPS,
+	// and regains a twentieth of RPS with every successful response.
+	Adaptive bool
+	// MinRPS is the lowest adaptive rate, a tenth of RPS if 0.
+	MinRPS float64
+}
+
+// RateLimitError is returned for the requests which could not be sent before their context was done.
+type RateLimitError struct {
+	Host string
+	Err  error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit of %s: %v", e.Host, e.Err)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+// Code returns ResourceExhausted.
+func (e *RateLimitError) Code() errors.Code {
+	return errors.ResourceExhausted
+}
+
+// RateLimiter limits the requests of a client per upstream host.
+type RateLimiter struct {
+	cfg RateLimitConfig
+
+	mu    sync.Mutex
+	hosts map[string]*rate.Limiter
+}
+
+// NewRateLimiter returns a RateLimiter of cfg.
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	if cfg.Burst <= 0 {
+		cfg.Burst = int(math.Ceil(cfg.RPS))
+	}
+	if cfg.MinRPS <= 0 {
+		cfg.MinRPS = cfg.RPS / 10
+	}
+	return &RateLimiter{cfg: cfg, hosts: make(map[string]*rate.Limiter)}
+}
+
+// Apply installs l on c, every attempt of a request waits for its turn.
+func (l *RateLimiter) Apply(c *resty.Client) {
+	c.OnBeforeRequest(func(c *resty.Client, r *resty.Request) error {
+		return l.Wait(r.Context(), HostOf(c, r))
+	})
+	if l.cfg.Adaptive {
+		c.OnAfterResponse(func(c *resty.Client, resp *resty.Response) error {
+			l.adapt(HostOf(c, resp.Request), resp.StatusCode())
+			return nil
+		})
+	}
+}
+
+// Wait blocks until a request to host is allowed. It fails at once with a *RateLimitError
+// if ctx is done, or its deadline comes before the turn of the request.
+func (l *RateLimiter) Wait(ctx context.Context, host string) error {
+	if l.cfg.RPS <= 0 {
+		return nil
+	}
+	if err := l.limiter(host).Wait(ctx); err != nil {
+		return &RateLimitError{Host: host, Err: err}
+	}
+	return nil
+}
+
+func (l *RateLimiter) limiter(host string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limiter, ok := l.hosts[host]
+	if !ok {
+		limiter = rate.NewLimiter(rate.Limit(l.cfg.RPS), l.cfg.Burst)
+		l.hosts[host] = limiter
+	}
+	return limiter
+}
+
+// adapt slows the requests to host down on a 429 response, and speeds them up again on a successful one.
+func (l *RateLimiter) adapt(host string, status int) {
+	if l.cfg.RPS <= 0 {
+		return
+	}
+	limiter := l.limiter(host)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	current := float64(limiter.Limit())
+	switch {
+	case status == http.StatusTooManyRequests:
+		if lowered := math.Max(current/2, l.cfg.MinRPS); lowered < current {
+			limiter.SetLimit(rate.Limit(lowered))
+			log.Slogger.Warnf("Rate limit of %s lowered to %.2f requests per second after a 429 response", host, lowered)
+		}
+	case status < http.StatusBadRequest && current < l.cfg.RPS:
+		raised := math.Min(current+l.cfg.RPS/20, l.cfg.RPS)
+		limiter.SetLimit(rate.Limit(raised))
+		if raised == l.cfg.RPS {
+			log.Slogger.Infof("Rate limit of %s restored to %.2f requests per second", host, raised)
+		}
+	}
+}
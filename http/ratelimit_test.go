@@ -0,0 +1,101 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/log/logtest"
+	"github.com/go-resty/resty/v2"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer srv.Close()
+
+	c := resty.New()
+	NewRateLimiter(RateLimitConfig{RPS: 1}).Apply(c)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	if _, err := c.R().SetContext(ctx).Get(srv.URL); err != nil {
+		t.Fatalf("first Get() error = %v", err)
+	}
+	start := time.Now()
+	_, err := c.R().SetContext(ctx).Get(srv.URL)
+	var limitErr *RateLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("second Get() error = %v, want a *RateLimitError", err)
+	}
+	if took := time.Since(start); took > 50*time.Millisecond {
+		t.Errorf("second Get() took %v, want to fail at once", took)
+	}
+	if calls != 1 {
+		t.Errorf("calls = %v, want 1", calls)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	l := NewRateLimiter(RateLimitConfig{RPS: 20, Burst: 1})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(context.Background(), "a:80"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if took := time.Since(start); took < 80*time.Millisecond {
+		t.Errorf("3 requests at 20/s took %v, want about 100ms", took)
+	}
+	// hosts have their own buckets.
+	start = time.Now()
+	if err := l.Wait(context.Background(), "b:80"); err != nil || time.Since(start) > 20*time.Millisecond {
+		t.Errorf("Wait() of another host error = %v after %v, want no wait", err, time.Since(start))
+	}
+}
+
+func TestRateLimiterAdapt(t *testing.T) {
+	logtest.New(t)
+	l := NewRateLimiter(RateLimitConfig{RPS: 10, Adaptive: true})
+	tests := []struct {
+		status int
+		want   float64
+	}{
+		{http.StatusTooManyRequests, 5},
+		{http.StatusTooManyRequests, 2.5},
+		{http.StatusTooManyRequests, 1.25},
+		{http.StatusTooManyRequests, 1},
+		{http.StatusInternalServerError, 1},
+		{http.StatusOK, 1.5},
+		{http.StatusOK, 2},
+	}
+	for _, tt := range tests {
+		l.adapt("a:80", tt.status)
+		if got := float64(l.limiter("a:80").Limit()); got != tt.want {
+			t.Errorf("limit after %d = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
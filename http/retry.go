@@ -0,0 +1,219 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/time/rate"
+)
+
+// IdempotencyKeyHeader marks a non-idempotent request as safe to retry.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// DefaultRetryStatuses are retried unless http.retries.statuses is set.
+var DefaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy decides which failed requests are retried and how long to wait before.
+type RetryPolicy struct {
+	// Statuses are retried, network errors always are.
+	Statuses []int
+	// NonIdempotent also retries POST and PATCH requests without an Idempotency-Key header.
+	NonIdempotent bool
+	// MaxDelay is the longest Retry-After honoured, the request is not retried if the server asks for more.
+	MaxDelay time.Duration
+	// Backoff computes the delay if the response has no Retry-After header.
+	Backoff Backoff
+	// Budget caps the retries over all requests, nil does not.
+	Budget *RetryBudget
+}
+
+// Apply installs the policy on c. It is meant to be called once per client,
+// since resty retries if any of the retry conditions added to c holds.
+func (p *RetryPolicy) Apply(c *resty.Client) {
+	new(retrySetting).apply(c, p)
+}
+
+// retrySetting is the retry policy of a client, which can be replaced after it is applied.
+// Its owner keeps it as long as the client, e.g. the package does for Client.
+type retrySetting struct {
+	once   sync.Once
+	policy atomic.Pointer[RetryPolicy]
+}
+
+// apply makes p the policy of c, adding the retry condition and the budget hook to c on the first call only.
+func (s *retrySetting) apply(c *resty.Client, p *RetryPolicy) {
+	s.policy.Store(p)
+	s.once.Do(func() {
+		c.SetRetryAfter(func(c *resty.Client, resp *resty.Response) (time.Duration, error) {
+			return s.policy.Load().retryAfter(c, resp)
+		}).AddRetryCondition(func(resp *resty.Response, err error) bool {
+			return s.policy.Load().Retry(resp, err)
+		}).OnBeforeRequest(func(_ *resty.Client, r *resty.Request) error {
+			// only first attempts earn retries.
+			if p := s.policy.Load(); p.Budget != nil && r.Attempt <= 1 {
+				p.Budget.deposit()
+			}
+			return nil
+		})
+	})
+}
+
+// Retry reports whether the request of resp failed with err should be retried.
+func (p *RetryPolicy) Retry(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil || !p.retryableMethod(resp.Request) {
+		return false
+	}
+	if resp.Request.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		if !retryableError(err) {
+			return false
+		}
+	} else {
+		if !p.retryableStatus(resp.StatusCode()) {
+			return false
+		}
+		if d, ok := parseRetryAfter(resp.Header().Get("Retry-After"), time.Now()); ok && p.MaxDelay > 0 && d > p.MaxDelay {
+			return false
+		}
+	}
+	return p.Budget == nil || p.Budget.withdraw()
+}
+
+func (p *RetryPolicy) retryableMethod(r *resty.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return p.NonIdempotent || r.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+func (p *RetryPolicy) retryableStatus(status int) bool {
+	for _, s := range p.Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// retryableError reports whether err is a transport error worth retrying,
+// a canceled request, an untrusted certificate, invalid tls settings or an open circuit is not.
+func retryableError(err error) bool {
+	var (
+		certErr     *tls.CertificateVerificationError
+		settingsErr *TLSSettingsError
+		circuitErr  *CircuitOpenError
+	)
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) &&
+		!errors.As(err, &certErr) && !errors.As(err, &settingsErr) && !errors.As(err, &circuitErr)
+}
+
+// retryAfter waits as the Retry-After header or else the backoff says.
+// It gives up if the wait outlasts the deadline of the request context.
+func (p *RetryPolicy) retryAfter(c *resty.Client, resp *resty.Response) (time.Duration, error) {
+	d, err := p.delay(c, resp)
+	if err != nil || resp == nil || resp.Request == nil {
+		return d, err
+	}
+	if deadline, ok := resp.Request.Context().Deadline(); ok && time.Until(deadline) <= d {
+		return 0, fmt.Errorf("retry in %v would exceed the request deadline", d)
+	}
+	return d, nil
+}
+
+func (p *RetryPolicy) delay(c *resty.Client, resp *resty.Response) (time.Duration, error) {
+	if resp != nil && resp.RawResponse != nil {
+		if d, ok := parseRetryAfter(resp.Header().Get("Retry-After"), time.Now()); ok {
+			// resty uses its own backoff for 0.
+			return time.Duration(math.Max(float64(d), 1)), nil
+		}
+	}
+	if p.Backoff == nil {
+		return 0, nil
+	}
+	return retryAfter(p.Backoff)(c, resp)
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// RetryBudget caps the retries of a client at Ratio of its requests plus MinPerSecond,
+// so that retries cannot amplify the load on a failing server.
+type RetryBudget struct {
+	ratio   float64
+	reserve *rate.Limiter
+
+	mu      sync.Mutex
+	balance float64
+}
+
+// maxBudgetRequests bounds the requests whose ratio is saved up.
+const maxBudgetRequests = 1000
+
+// NewRetryBudget returns a RetryBudget allowing ratio retries per request and minPerSecond retries regardless.
+func NewRetryBudget(ratio float64, minPerSecond int) *RetryBudget {
+	return &RetryBudget{ratio: ratio, reserve: rate.NewLimiter(rate.Limit(minPerSecond), minPerSecond)}
+}
+
+func (b *RetryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.balance = math.Min(b.balance+b.ratio, b.ratio*maxBudgetRequests)
+}
+
+func (b *RetryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.balance >= 1 {
+		b.balance--
+		return true
+	}
+	return b.reserve.Allow()
+}
@@ -0,0 +1,122 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		header     map[string]string
+		status     int
+		retryAfter string
+		budget     *RetryBudget
+		wantCalls  int32
+	}{
+		{"ServiceUnavailable", http.MethodGet, nil, http.StatusServiceUnavailable, "", nil, 3},
+		{"NotFound", http.MethodGet, nil, http.StatusNotFound, "", nil, 1},
+		{"Created", http.MethodPut, nil, http.StatusCreated, "", nil, 1},
+		{"Post", http.MethodPost, nil, http.StatusServiceUnavailable, "", nil, 1},
+		{"PostWithIdempotencyKey", http.MethodPost, map[string]string{IdempotencyKeyHeader: "k1"}, http.StatusServiceUnavailable, "", nil, 3},
+		{"RetryAfter", http.MethodGet, nil, http.StatusTooManyRequests, "0", nil, 3},
+		{"RetryAfterTooLong", http.MethodGet, nil, http.StatusTooManyRequests, "120", nil, 1},
+		{"BudgetExhausted", http.MethodGet, nil, http.StatusServiceUnavailable, "", NewRetryBudget(1, 0), 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&calls, 1)
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer srv.Close()
+
+			b, _ := NewBackoff(BackoffConfig{Strategy: StrategyNone, MinDelay: time.Millisecond})
+			c := resty.New().SetRetryCount(2).SetRetryWaitTime(time.Millisecond).SetRetryMaxWaitTime(time.Second)
+			p := &RetryPolicy{Statuses: DefaultRetryStatuses, MaxDelay: time.Second, Backoff: b, Budget: tt.budget}
+			p.Apply(c)
+
+			if _, err := c.R().SetHeaders(tt.header).Execute(tt.method, srv.URL); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryNetworkError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	url := srv.URL
+	srv.Close()
+
+	var attempts int
+	b, _ := NewBackoff(BackoffConfig{MinDelay: time.Millisecond})
+	c := resty.New().SetRetryCount(2).SetRetryWaitTime(time.Millisecond)
+	(&RetryPolicy{Statuses: DefaultRetryStatuses, Backoff: b}).Apply(c)
+	c.OnBeforeRequest(func(*resty.Client, *resty.Request) error {
+		attempts++
+		return nil
+	})
+	if _, err := c.R().Get(url); err == nil {
+		t.Fatalf("Get() of a closed server succeeded")
+	}
+	if attempts != 3 {
+		t.Errorf("attempts = %v, want 3", attempts)
+	}
+}
+
+func TestRetrySettingApplyTwice(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	b, _ := NewBackoff(BackoffConfig{Strategy: StrategyNone, MinDelay: time.Millisecond})
+	c := resty.New().SetRetryCount(5).SetRetryWaitTime(time.Millisecond)
+	var rs retrySetting
+	rs.apply(c, &RetryPolicy{Statuses: []int{http.StatusNotFound}, Backoff: b})
+	// the budget is deposited once per request, so it allows a single retry.
+	budget := NewRetryBudget(1, 0)
+	rs.apply(c, &RetryPolicy{Statuses: DefaultRetryStatuses, Backoff: b, Budget: budget})
+	if n := len(c.RetryConditions); n != 1 {
+		t.Errorf("retry conditions = %v, want 1", n)
+	}
+
+	if _, err := c.R().Get(srv.URL); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("calls = %v, want 2 with the budget of the last policy", calls)
+	}
+}
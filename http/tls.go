@@ -0,0 +1,496 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/errors"
+	"github.com/cauwulixuan/go-kit/log"
+	"github.com/fsnotify/fsnotify"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/viper"
+)
+
+const (
+	// reloadDelay lets the writes of a rotation settle before the files are read.
+	reloadDelay = 200 * time.Millisecond
+	// expiryCheckInterval is how often the certificates are checked for their expiry besides on reload.
+	expiryCheckInterval = 12 * time.Hour
+)
+
+// TLSConfig are the TLS settings of a client, or of an upstream host overriding them.
+type TLSConfig struct {
+	// Host is the host or host:port of an override.
+	Host string `mapstructure:"host"`
+	// CAFile is a PEM CA bundle trusted instead of the system roots.
+	CAFile string `mapstructure:"ca_file"`
+	// CertFile and KeyFile are the PEM client certificate and key for mTLS.
+	CertFile   string `mapstructure:"cert_file"`
+	KeyFile    string `mapstructure:"key_file"`
+	ServerName string `mapstructure:"server_name"`
+	// MinVersion is 1.0, 1.1, 1.2 or 1.3, Go's default if "".
+	MinVersion string `mapstructure:"min_version"`
+	// InsecureSkipVerify is false if nil, an override leaves the setting of the client as is if nil,
+	// so that an explicit false verifies the host again.
+	InsecureSkipVerify *bool `mapstructure:"insecure_skip_verify"`
+}
+
+func (c TLSConfig) isZero() bool {
+	return c.CAFile == "" && c.CertFile == "" && c.ServerName == "" && c.MinVersion == "" && !c.insecureSkipVerify()
+}
+
+func (c TLSConfig) insecureSkipVerify() bool {
+	return c.InsecureSkipVerify != nil && *c.InsecureSkipVerify
+}
+
+// override returns c with the settings o sets.
+func (c TLSConfig) override(o TLSConfig) TLSConfig {
+	for _, s := range []struct {
+		dst *string
+		src string
+	}{
+		{&c.CAFile, o.CAFile}, {&c.CertFile, o.CertFile}, {&c.KeyFile, o.KeyFile},
+		{&c.ServerName, o.ServerName}, {&c.MinVersion, o.MinVersion},
+	} {
+		if s.src != "" {
+			*s.dst = s.src
+		}
+	}
+	if o.InsecureSkipVerify != nil {
+		c.InsecureSkipVerify = o.InsecureSkipVerify
+	}
+	c.Host = o.Host
+	return c
+}
+
+// files returns the files c reads.
+func (c TLSConfig) files() []string {
+	var files []string
+	for _, f := range []string{c.CAFile, c.CertFile, c.KeyFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// loadedCert is a certificate read from file, checked for its expiry.
+type loadedCert struct {
+	file string
+	cert *x509.Certificate
+}
+
+// build returns the tls.Config of c and the certificates it read.
+func (c TLSConfig) build() (*tls.Config, []loadedCert, error) {
+	cfg := &tls.Config{ServerName: c.ServerName, InsecureSkipVerify: c.insecureSkipVerify()}
+	var err error
+	if cfg.MinVersion, err = parseTLSVersion(c.MinVersion); err != nil {
+		return nil, nil, err
+	}
+	var loaded []loadedCert
+	if c.CAFile != "" {
+		data, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, nil, fmt.Errorf("parse %s: %w", c.CAFile, err)
+			}
+			cfg.RootCAs.AddCert(cert)
+			loaded = append(loaded, loadedCert{file: c.CAFile, cert: cert})
+		}
+		if len(loaded) == 0 {
+			return nil, nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("parse %s: %w", c.CertFile, err)
+		}
+		cert.Leaf = leaf
+		cfg.Certificates = []tls.Certificate{cert}
+		loaded = append(loaded, loadedCert{file: c.CertFile, cert: leaf})
+	}
+	return cfg, loaded, nil
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch strings.TrimPrefix(strings.ToLower(v), "tls") {
+	case "":
+		return 0, nil
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q, want 1.0, 1.1, 1.2 or 1.3", v)
+}
+
+// tlsTransport sends the requests with the transport of the TLS settings of their host.
+// The transports are rebuilt once the files of the settings change, e.g. when cert-manager
+// rotates a mounted secret, the connections in use are kept until they are idle.
+type tlsTransport struct {
+	name       string
+	base       *http.Transport
+	def        TLSConfig
+	hosts      []TLSConfig
+	warnBefore time.Duration
+	now        func() time.Time
+
+	current atomic.Pointer[tlsTransports]
+	watcher *fsnotify.Watcher
+	stop    chan struct{}
+	stopped sync.Once
+}
+
+// tlsTransports are the transports built from the files as they were read.
+type tlsTransports struct {
+	def   *http.Transport
+	hosts map[string]*http.Transport
+	certs []loadedCert
+}
+
+// newTLSTransport returns a tlsTransport of base with the settings def, overridden per host by hosts,
+// warning of the certificates which expire within warnBefore.
+func newTLSTransport(name string, base *http.Transport, def TLSConfig, hosts []TLSConfig, warnBefore time.Duration) (*tlsTransport, error) {
+	t := &tlsTransport{name: name, base: base, def: def, hosts: hosts, warnBefore: warnBefore, now: time.Now, stop: make(chan struct{})}
+	if err := t.reload(); err != nil {
+		return nil, err
+	}
+
+	dirs := make(map[string]bool)
+	for _, c := range append([]TLSConfig{def}, hosts...) {
+		for _, f := range c.files() {
+			dirs[filepath.Dir(f)] = true
+		}
+	}
+	if len(dirs) == 0 {
+		return t, nil
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	t.watcher = watcher
+	go t.watch()
+	return t, nil
+}
+
+// reload builds the transports from the files and checks the certificates for their expiry.
+func (t *tlsTransport) reload() error {
+	ts := &tlsTransports{hosts: make(map[string]*http.Transport)}
+	build := func(c TLSConfig) (*http.Transport, error) {
+		cfg, certs, err := c.build()
+		if err != nil {
+			return nil, err
+		}
+		ts.certs = append(ts.certs, certs...)
+		transport := t.base.Clone()
+		transport.TLSClientConfig = cfg
+		return transport, nil
+	}
+	var err error
+	if ts.def, err = build(t.def); err != nil {
+		return err
+	}
+	for _, h := range t.hosts {
+		if ts.hosts[h.Host], err = build(t.def.override(h)); err != nil {
+			return fmt.Errorf("tls of host %s: %w", h.Host, err)
+		}
+	}
+
+	if prev := t.current.Swap(ts); prev != nil {
+		prev.closeIdleConnections()
+	}
+	t.checkExpiry()
+	return nil
+}
+
+func (t *tlsTransport) checkExpiry() {
+	now := t.now()
+	for _, c := range t.current.Load().certs {
+		if left := c.cert.NotAfter.Sub(now); left < t.warnBefore {
+			log.Slogger.Warnf("Certificate %s of %s in %s of HTTP client %s expires at %s, in %v",
+				c.cert.Subject.CommonName, c.cert.Issuer.CommonName, c.file, t.name, c.cert.NotAfter.Format(time.RFC3339), left.Round(time.Minute))
+		}
+	}
+}
+
+func (t *tlsTransport) watch() {
+	var (
+		files  = make(map[string]bool)
+		reload = time.NewTimer(time.Hour)
+		expiry = time.NewTicker(expiryCheckInterval)
+	)
+	reload.Stop()
+	defer expiry.Stop()
+	for _, c := range append([]TLSConfig{t.def}, t.hosts...) {
+		for _, f := range c.files() {
+			files[filepath.Base(f)] = true
+		}
+	}
+	for {
+		select {
+		case e, ok := <-t.watcher.Events:
+			if !ok {
+				return
+			}
+			// Kubernetes swaps the ..data symlink of a secret volume.
+			if name := filepath.Base(e.Name); files[name] || strings.HasPrefix(name, "..") {
+				reload.Reset(reloadDelay)
+			}
+		case err, ok := <-t.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Slogger.Errorf("Watching TLS files of HTTP client %s failed, error: %v", t.name, err)
+		case <-reload.C:
+			if err := t.reload(); err != nil {
+				log.Slogger.Errorf("Reloading TLS files of HTTP client %s failed, keeping the previous ones, error: %v", t.name, err)
+				continue
+			}
+			log.Slogger.Infof("Reloaded TLS files of HTTP client %s", t.name)
+		case <-expiry.C:
+			t.checkExpiry()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+func (t *tlsTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.current.Load().forHost(r.URL.Host).RoundTrip(r)
+}
+
+// CloseIdleConnections closes the idle connections of the transports.
+func (t *tlsTransport) CloseIdleConnections() {
+	t.current.Load().closeIdleConnections()
+}
+
+// Close stops watching the files.
+func (t *tlsTransport) Close() {
+	t.stopped.Do(func() {
+		close(t.stop)
+		if t.watcher != nil {
+			t.watcher.Close()
+		}
+	})
+}
+
+// forHost returns the transport of host:port, or else of host, or else the default one.
+func (ts *tlsTransports) forHost(host string) *http.Transport {
+	if transport, ok := ts.hosts[host]; ok {
+		return transport
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		if transport, ok := ts.hosts[name]; ok {
+			return transport
+		}
+	}
+	return ts.def
+}
+
+func (ts *tlsTransports) closeIdleConnections() {
+	ts.def.CloseIdleConnections()
+	for _, transport := range ts.hosts {
+		transport.CloseIdleConnections()
+	}
+}
+
+var (
+	tlsTransportsMu sync.Mutex
+	// tlsTransportsOf are the transports of the clients by section, stopped once a client is rebuilt.
+	tlsTransportsOf = make(map[section]*tlsTransport)
+)
+
+// TLSSettingsError fails the requests of a client whose tls settings are invalid, rather than
+// sending them with the system roots and without the client certificate.
+type TLSSettingsError struct {
+	// Client is the name of the client in http.clients, "" for Client.
+	Client string
+	Err    error
+}
+
+func (e *TLSSettingsError) Error() string {
+	if e.Client == "" {
+		return fmt.Sprintf("invalid TLS settings of the HTTP client: %v", e.Err)
+	}
+	return fmt.Sprintf("invalid TLS settings of HTTP client %s: %v", e.Client, e.Err)
+}
+
+func (e *TLSSettingsError) Unwrap() error {
+	return e.Err
+}
+
+// Code returns FailedPrecondition.
+func (e *TLSSettingsError) Code() errors.Code {
+	return errors.FailedPrecondition
+}
+
+// errTransport fails every request with err, base is the transport the tls settings apply to once fixed.
+type errTransport struct {
+	err  error
+	base *http.Transport
+}
+
+func (t errTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Body != nil {
+		r.Body.Close()
+	}
+	return nil, t.err
+}
+
+// setTLS makes c use the tls settings of s, replacing the ones set before. It must be called
+// before the transport of c is wrapped by Instrument, NewBreakerTransport or Trace.
+// If the settings are invalid, the requests of c fail with a *TLSSettingsError.
+func setTLS(c *resty.Client, s section) error {
+	if err := applyTLS(c, s); err != nil {
+		base, _ := baseTransport(c.GetClient().Transport)
+		err = &TLSSettingsError{Client: string(s), Err: err}
+		c.SetTransport(errTransport{err: err, base: base})
+		stopTLSTransport(s, nil)
+		return err
+	}
+	return nil
+}
+
+func applyTLS(c *resty.Client, s section) error {
+	def, hosts, err := s.tlsSettings()
+	if err != nil {
+		return err
+	}
+	current := c.GetClient().Transport
+	base, err := baseTransport(current)
+	if def.isZero() && len(hosts) == 0 {
+		if err == nil && http.RoundTripper(base) != current {
+			c.SetTransport(base)
+		}
+		stopTLSTransport(s, nil)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	t, err := newTLSTransport(string(s), base, def, hosts, viper.GetDuration(s.key("tls.expiry_warning")))
+	if err != nil {
+		return err
+	}
+	c.SetTransport(t)
+	stopTLSTransport(s, t)
+	return nil
+}
+
+// baseTransport returns the *http.Transport the tls settings apply to, that of an earlier setTLS if any.
+func baseTransport(rt http.RoundTripper) (*http.Transport, error) {
+	switch t := rt.(type) {
+	case *http.Transport:
+		return t, nil
+	case *tlsTransport:
+		return t.base, nil
+	case errTransport:
+		if t.base != nil {
+			return t.base, nil
+		}
+	}
+	return nil, fmt.Errorf("TLS settings must be set before the metrics, breaker and tracing wrap the transport, it is a %T", rt)
+}
+
+// stopTLSTransport stops the tlsTransport of s, t takes its place if not nil.
+func stopTLSTransport(s section, t *tlsTransport) {
+	tlsTransportsMu.Lock()
+	defer tlsTransportsMu.Unlock()
+	if prev, ok := tlsTransportsOf[s]; ok {
+		prev.Close()
+		delete(tlsTransportsOf, s)
+	}
+	if t != nil {
+		tlsTransportsOf[s] = t
+	}
+}
+
+// tlsStamp identifies the tls files of s by their size and modification time.
+func (s section) tlsStamp() string {
+	def, hosts, _ := s.tlsSettings()
+	var b strings.Builder
+	for _, c := range append([]TLSConfig{def}, hosts...) {
+		for _, f := range c.files() {
+			if fi, err := os.Stat(f); err != nil {
+				fmt.Fprintf(&b, "%s:%v;", f, err)
+			} else {
+				fmt.Fprintf(&b, "%s:%d:%d;", f, fi.Size(), fi.ModTime().UnixNano())
+			}
+		}
+	}
+	return b.String()
+}
+
+// tlsSettings returns the tls settings of s and their overrides per upstream host.
+func (s section) tlsSettings() (TLSConfig, []TLSConfig, error) {
+	insecure := viper.GetBool(s.key("tls.insecure_skip_verify"))
+	def := TLSConfig{
+		CAFile:             viper.GetString(s.key("tls.ca_file")),
+		CertFile:           viper.GetString(s.key("tls.cert_file")),
+		KeyFile:            viper.GetString(s.key("tls.key_file")),
+		ServerName:         viper.GetString(s.key("tls.server_name")),
+		MinVersion:         viper.GetString(s.key("tls.min_version")),
+		InsecureSkipVerify: &insecure,
+	}
+	var hosts []TLSConfig
+	if err := viper.UnmarshalKey(s.key("tls.hosts"), &hosts); err != nil {
+		return def, nil, fmt.Errorf("tls.hosts: %w", err)
+	}
+	for _, h := range hosts {
+		if h.Host == "" {
+			return def, nil, fmt.Errorf("tls.hosts: an override without host")
+		}
+	}
+	return def, hosts, nil
+}
@@ -0,0 +1,326 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/log/logtest"
+	"github.com/go-resty/resty/v2"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue returns a certificate of cn valid for validFor, signed by ca or self-signed if ca is nil.
+func issue(t *testing.T, cn string, validFor time.Duration, ca *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	parent, signer := tmpl, key
+	if ca == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+		tmpl.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+// write writes the PEM certificate and key of c to dir as name.crt and name.key, replacing them atomically.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []struct {
+		path string
+		typ  string
+		der  []byte
+	}{
+		{filepath.Join(dir, name+".key"), "EC PRIVATE KEY", keyDER},
+		{filepath.Join(dir, name+".crt"), "CERTIFICATE", c.cert.Raw},
+	} {
+		tmp := f.path + ".tmp"
+		if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: f.typ, Bytes: f.der}), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, f.path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+}
+
+// newTLSServer returns a server of the certificate of cn signed by ca, which responds with the common name of the client certificate.
+func newTLSServer(t *testing.T, ca *testCert, requireClientCert bool) *httptest.Server {
+	t.Helper()
+	cert := issue(t, "server", time.Hour, ca)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert.cert.Raw}, PrivateKey: cert.key}}}
+	if requireClientCert {
+		srv.TLS.ClientCAs = x509.NewCertPool()
+		srv.TLS.ClientCAs.AddCert(ca.cert)
+		srv.TLS.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func closeTLSTransport(t *testing.T, s section) {
+	t.Cleanup(func() {
+		tlsTransportsMu.Lock()
+		defer tlsTransportsMu.Unlock()
+		if tt, ok := tlsTransportsOf[s]; ok {
+			tt.Close()
+			delete(tlsTransportsOf, s)
+		}
+		// a client ClientFor built for s is dropped along with it.
+		clientsMu.Lock()
+		defer clientsMu.Unlock()
+		delete(clients, string(s))
+	})
+}
+
+func TestTLSReload(t *testing.T) {
+	logs := logtest.New(t)
+	defer viper.Reset()
+	closeTLSTransport(t, "mtls")
+	dir := t.TempDir()
+	ca := issue(t, "ca", time.Hour, nil)
+	srv := newTLSServer(t, ca, true)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := issue(t, "client-1", time.Hour, ca).write(t, dir, "client")
+	viper.Set("http.clients.mtls.tls", map[string]interface{}{
+		"ca_file":   caFile,
+		"cert_file": certFile,
+		"key_file":  keyFile,
+	})
+
+	c := ClientFor("mtls")
+	resp, err := c.R().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got := resp.String(); got != "client-1" {
+		t.Errorf("client certificate = %v, want client-1", got)
+	}
+
+	issue(t, "client-2", time.Hour, ca).write(t, dir, "client")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		resp, err := c.R().Get(srv.URL)
+		if err == nil && resp.String() == "client-2" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client certificate = %v, error = %v, want the rotated client-2", resp, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	logs.AssertContains(zap.InfoLevel, "Reloaded TLS files of HTTP client mtls")
+	logs.AssertNoErrors()
+}
+
+func TestTLSHostOverride(t *testing.T) {
+	logtest.New(t)
+	defer viper.Reset()
+	closeTLSTransport(t, "hosts")
+	ca := issue(t, "ca", time.Hour, nil)
+	srv := newTLSServer(t, ca, false)
+	caFile, _ := ca.write(t, t.TempDir(), "ca")
+	other := newTLSServer(t, issue(t, "other-ca", time.Hour, nil), false)
+	viper.Set("http.clients.hosts.tls.hosts", []interface{}{
+		map[string]interface{}{"host": srv.Listener.Addr().String(), "ca_file": caFile},
+	})
+
+	c := ClientFor("hosts")
+	if _, err := c.R().Get(srv.URL); err != nil {
+		t.Errorf("Get() of the overridden host error = %v", err)
+	}
+	if _, err := c.R().Get(other.URL); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Get() of another host error = %v, want it verified against the system roots", err)
+	}
+}
+
+func TestTLSHostOverrideVerify(t *testing.T) {
+	logtest.New(t)
+	defer viper.Reset()
+	closeTLSTransport(t, "verify")
+	srv := newTLSServer(t, issue(t, "ca", time.Hour, nil), false)
+	other := newTLSServer(t, issue(t, "other-ca", time.Hour, nil), false)
+	viper.Set("http.clients.verify.tls.insecure_skip_verify", true)
+	// an explicit false verifies the overridden host again.
+	viper.Set("http.clients.verify.tls.hosts", []interface{}{
+		map[string]interface{}{"host": srv.Listener.Addr().String(), "insecure_skip_verify": false},
+	})
+
+	c := ClientFor("verify")
+	if _, err := c.R().Get(srv.URL); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Get() of the overridden host error = %v, want it verified", err)
+	}
+	if _, err := c.R().Get(other.URL); err != nil {
+		t.Errorf("Get() of another host error = %v, want it not verified", err)
+	}
+}
+
+func TestTLSInvalidSettings(t *testing.T) {
+	logs := logtest.New(t)
+	defer viper.Reset()
+	closeTLSTransport(t, "broken")
+	ca := issue(t, "ca", time.Hour, nil)
+	srv := newTLSServer(t, ca, false)
+	caFile := filepath.Join(t.TempDir(), "ca.crt")
+	viper.Set("http.clients.broken.tls.ca_file", caFile)
+
+	failed := ClientFor("broken")
+	_, err := failed.R().Get(srv.URL)
+	var settingsErr *TLSSettingsError
+	if !errors.As(err, &settingsErr) {
+		t.Fatalf("Get() error = %v, want a TLSSettingsError instead of the system roots", err)
+	}
+	// kept until the files change.
+	if c := ClientFor("broken"); c != failed {
+		t.Errorf("ClientFor() rebuilt the failed client while its files did not change")
+	}
+	if n := len(logs.Filter(zapcore.ErrorLevel, "Building HTTP client broken failed")); n != 1 {
+		t.Errorf("logged the failure %v times, want once", n)
+	}
+
+	ca.write(t, filepath.Dir(caFile), "ca")
+	if _, err := ClientFor("broken").R().Get(srv.URL); err != nil {
+		t.Errorf("Get() error = %v once the CA file exists", err)
+	}
+}
+
+func TestSetTLSAgain(t *testing.T) {
+	logtest.New(t)
+	defer viper.Reset()
+	closeTLSTransport(t, "again")
+	ca := issue(t, "ca", time.Hour, nil)
+	srv := newTLSServer(t, ca, false)
+	caFile, _ := ca.write(t, t.TempDir(), "ca")
+	viper.Set("http.clients.again.tls.ca_file", caFile)
+
+	c := resty.New()
+	for i := 0; i < 2; i++ {
+		if err := setTLS(c, "again"); err != nil {
+			t.Fatalf("setTLS() #%d error = %v", i, err)
+		}
+		if _, err := c.R().Get(srv.URL); err != nil {
+			t.Errorf("Get() after setTLS() #%d error = %v", i, err)
+		}
+	}
+
+	Instrument(c)
+	if err := setTLS(c, "again"); err == nil {
+		t.Fatalf("setTLS() after Instrument() error = nil, want the order enforced")
+	}
+	var settingsErr *TLSSettingsError
+	if _, err := c.R().Get(srv.URL); !errors.As(err, &settingsErr) {
+		t.Errorf("Get() error = %v, want a TLSSettingsError", err)
+	}
+}
+
+func TestTLSExpiryWarning(t *testing.T) {
+	logs := logtest.New(t)
+	defer viper.Reset()
+	closeTLSTransport(t, "expiring")
+	dir := t.TempDir()
+	ca := issue(t, "ca", 365*24*time.Hour, nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := issue(t, "client", 24*time.Hour, ca).write(t, dir, "client")
+	viper.Set("http.tls.expiry_warning", "720h")
+	viper.Set("http.clients.expiring.tls", map[string]interface{}{
+		"ca_file":   caFile,
+		"cert_file": certFile,
+		"key_file":  keyFile,
+	})
+
+	ClientFor("expiring")
+	logs.AssertContains(zap.WarnLevel, "Certificate client of ca in "+certFile)
+	if logs.Contains(zap.WarnLevel, "Certificate ca of ca") {
+		t.Errorf("warned of the CA valid for a year, logged:\n%s", logs)
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"1.0", tls.VersionTLS10, false},
+		{"1.2", tls.VersionTLS12, false},
+		{"TLS1.3", tls.VersionTLS13, false},
+		{"2.0", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTLSVersion(tt.version)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseTLSVersion(%q) = %v, %v, want %v, error %v", tt.version, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cauwulixuan/go-kit/trace"
+	"github.com/go-resty/resty/v2"
+)
+
+// Trace starts a client span for every attempt of the requests of c, the child of the span of the
+// request context, and sends its context in the traceparent header. The spans have the method, host,
+// status and the number of retries before as attributes.
+// It wraps the transport of c, so it comes after the TLS settings, Instrument and SetBreaker.
+func Trace(c *resty.Client) {
+	c.SetTransport(&tracingTransport{next: c.GetClient().Transport})
+	c.OnBeforeRequest(func(_ *resty.Client, r *resty.Request) error {
+		r.SetContext(context.WithValue(r.Context(), attemptKey{}, r.Attempt))
+		return nil
+	})
+}
+
+type attemptKey struct{}
+
+// tracingTransport is a http.RoundTripper with a span per attempt.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	ctx, span := trace.Start(r.Context(), "HTTP "+r.Method, trace.KindClient)
+	defer span.End()
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("http.host", r.URL.Host)
+	span.SetAttribute("http.path", r.URL.Path)
+	if attempt, ok := r.Context().Value(attemptKey{}).(int); ok && attempt > 1 {
+		span.SetAttribute("http.retries", attempt-1)
+	}
+
+	// a RoundTripper must not modify the request.
+	r = r.Clone(ctx)
+	trace.Inject(ctx, r.Header)
+	resp, err := next.RoundTrip(r)
+	if err != nil {
+		span.RecordError(err)
+		return resp, err
+	}
+	span.SetAttribute("http.status_code", resp.StatusCode)
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.RecordError(fmt.Errorf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode)))
+	}
+	return resp, nil
+}
+
+// CloseIdleConnections closes the idle connections of the wrapped transport.
+func (t *tracingTransport) CloseIdleConnections() {
+	if c, ok := t.next.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// propagateTrace sends the span context of the request context on, unless the request has one.
+// Without Trace the callee becomes a child of the current span.
+func propagateTrace(ctx context.Context, h http.Header) {
+	if h.Get(trace.TraceparentHeader) == "" {
+		trace.Inject(ctx, h)
+	}
+}
+
+// TraceHandler starts a server span for every inbound request, the child of the span
+// of its traceparent or B3 headers, and puts it into the request context.
+func TraceHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := trace.Start(trace.Extract(r.Context(), r.Header), "HTTP "+r.Method, trace.KindServer)
+		defer span.End()
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.path", r.URL.Path)
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetAttribute("http.status_code", sw.status)
+		if sw.status >= http.StatusInternalServerError {
+			span.RecordError(fmt.Errorf("%d %s", sw.status, http.StatusText(sw.status)))
+		}
+	})
+}
+
+// statusWriter records the status written to a http.ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright 2022 The Inspur AIStation Group Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Note: the example only works with the code within the same release/branch.
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/trace"
+	"github.com/go-resty/resty/v2"
+)
+
+func TestTrace(t *testing.T) {
+	exporter := trace.NewMemoryExporter()
+	defer trace.SetExporter(exporter)()
+
+	var calls int32
+	var traceparents []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents = append(traceparents, r.Header.Get(trace.TraceparentHeader))
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer upstream.Close()
+
+	b, _ := NewBackoff(BackoffConfig{Strategy: StrategyNone, MinDelay: time.Millisecond})
+	c := resty.New().OnBeforeRequest(propagate).SetRetryCount(2).SetRetryWaitTime(time.Millisecond)
+	(&RetryPolicy{Statuses: DefaultRetryStatuses, Backoff: b}).Apply(c)
+	Trace(c)
+	srv := httptest.NewServer(TraceHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := c.R().SetContext(r.Context()).Get(upstream.URL + "/users"); err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	})))
+	defer srv.Close()
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	if _, err := resty.New().R().SetHeader(trace.TraceparentHeader, "00-"+traceID+"-00f067aa0ba902b7-01").Get(srv.URL); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := exporter.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("exported %+v, want 2 client spans and a server span", spans)
+	}
+	server := spans[2]
+	if server.Kind != trace.KindServer || server.ParentID != "00f067aa0ba902b7" || server.TraceID != traceID {
+		t.Errorf("server span = %+v", server)
+	}
+	for i, span := range spans[:2] {
+		if span.Kind != trace.KindClient || span.TraceID != traceID || span.ParentID != server.SpanID {
+			t.Errorf("client span %d = %+v, want a child of the server span", i, span)
+		}
+		if want := "00-" + traceID + "-" + span.SpanID + "-01"; traceparents[i] != want {
+			t.Errorf("traceparent of attempt %d = %v, want %v", i+1, traceparents[i], want)
+		}
+	}
+	if spans[0].Attributes["http.status_code"] != http.StatusServiceUnavailable || spans[0].Error == "" || spans[0].Attributes["http.retries"] != nil {
+		t.Errorf("first attempt span = %+v", spans[0])
+	}
+	if spans[1].Attributes["http.status_code"] != http.StatusOK || spans[1].Attributes["http.retries"] != 1 {
+		t.Errorf("retry span = %+v", spans[1])
+	}
+}
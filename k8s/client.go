@@ -18,13 +18,20 @@ limitations under the License.
 package k8s
 
 import (
+	"context"
+	"github.com/cauwulixuan/go-kit/audit"
 	"github.com/cauwulixuan/go-kit/file"
 	"github.com/cauwulixuan/go-kit/log"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
+	"net/http"
 	"path/filepath"
+	"time"
 )
 
 var Client *kubernetes.Clientset
@@ -62,9 +69,59 @@ func GenerateClientSet(kubePath string) {
 		log.Slogger.Error(err.Error())
 	}
 
+	// client-side rate limit, as the API server throttles bursts
+	if config != nil {
+		config.QPS = float32(viper.GetFloat64("k8s.qps"))
+		config.Burst = viper.GetInt("k8s.burst")
+	}
+
+	// record mutations to the audit file
+	if config != nil && viper.GetBool("audit.k8s") {
+		actor := viper.GetString("audit.actor")
+		if actor == "" {
+			actor = viper.GetString("svc_name")
+		}
+		config.Wrap(func(rt http.RoundTripper) http.RoundTripper {
+			return audit.Transport(actor, rt)
+		})
+	}
+
 	// create the clientset
 	Client, err = kubernetes.NewForConfig(config)
 	if err != nil {
 		log.Slogger.Error(err.Error())
+		return
+	}
+
+	if viper.GetBool("log.k8s.enable") && viper.GetBool("log.k8s.lookup") {
+		addPodLogFields()
+	}
+}
+
+// addPodLogFields adds the labels and controller of the own Pod to the log fields.
+// The Pod is not looked up outside a cluster.
+func addPodLogFields() {
+	info, ok := log.CurrentPod()
+	if !ok || info.Name == "" || info.Namespace == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	pod, err := Client.CoreV1().Pods(info.Namespace).Get(ctx, info.Name, metav1.GetOptions{})
+	if err != nil {
+		log.Slogger.Warnf("Look up pod %s/%s for log fields failed, error: %v", info.Namespace, info.Name, err)
+		return
+	}
+
+	var fields []zap.Field
+	if len(pod.Labels) > 0 && len(info.Labels) == 0 {
+		fields = append(fields, log.PodField("labels", pod.Labels))
+	}
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		fields = append(fields, log.PodField("owner", owner.Kind+"/"+owner.Name))
+	}
+	if info.Node == "" && pod.Spec.NodeName != "" {
+		fields = append(fields, log.PodField("node", pod.Spec.NodeName))
 	}
+	log.AddFields(fields...)
 }
@@ -0,0 +1,332 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/metrics"
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/time/rate"
+)
+
+var alertsDropped = metrics.Factory().NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "log_alerts",
+	Name:      "dropped_total",
+	Help:      "Number of alerts dropped, by reason.",
+}, []string{"reason"})
+
+// Alert is sent to the registered AlertSinks for entries at or above the alert level.
+type Alert struct {
+	Fingerprint string                 `json:"fingerprint"`
+	Service     string                 `json:"service"`
+	Level       string                 `json:"level"`
+	Message     string                 `json:"message"`
+	Caller      string                 `json:"caller"`
+	Time        time.Time              `json:"time"`
+	Fields      map[string]interface{} `json:"fields,omitempty"`
+	Stack       string                 `json:"stack,omitempty"`
+	// Suppressed counts the alerts with the same fingerprint deduplicated since the last one sent.
+	Suppressed int `json:"suppressed"`
+}
+
+// AlertSink delivers alerts, it is called from a single background goroutine.
+type AlertSink interface {
+	Send(a Alert) error
+}
+
+// AlertFunc is an in-process AlertSink.
+type AlertFunc func(a Alert)
+
+func (f AlertFunc) Send(a Alert) error {
+	f(a)
+	return nil
+}
+
+// WebhookSink posts every alert as JSON to URL.
+type WebhookSink struct {
+	URL    string
+	Client *resty.Client
+}
+
+func (s WebhookSink) Send(a Alert) error {
+	return postAlert(s.Client, s.URL, a)
+}
+
+// SlackSink posts alerts to a Slack compatible incoming webhook.
+type SlackSink struct {
+	URL    string
+	Client *resty.Client
+}
+
+func (s SlackSink) Send(a Alert) error {
+	text := fmt.Sprintf("*[%s] %s*: %s\n`%s`", a.Level, a.Service, a.Message, a.Caller)
+	if a.Suppressed > 0 {
+		text += fmt.Sprintf("\n_%d similar alerts suppressed_", a.Suppressed)
+	}
+	return postAlert(s.Client, s.URL, map[string]string{"text": text})
+}
+
+func postAlert(client *resty.Client, url string, body interface{}) error {
+	if client == nil {
+		client = alertClient
+	}
+	resp, err := client.R().SetBody(body).Post(url)
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return fmt.Errorf("alert webhook responded with status code %d", resp.StatusCode())
+	}
+	return nil
+}
+
+var (
+	alertClient = resty.New().SetTimeout(10 * time.Second)
+	alerts      = newAlerter()
+	// alertsOnce registers the configured sinks only once across Init calls.
+	alertsOnce sync.Once
+
+	// digits are masked so that messages only differing in ids or counts share a fingerprint.
+	alertDigits = regexp.MustCompile(`\d+`)
+)
+
+// AlertConfig controls grouping and rate limiting of alerts.
+type AlertConfig struct {
+	// Level is the min level of entries raising alerts, ERROR by default.
+	Level zapcore.Level
+	// Window deduplicates alerts with the same fingerprint.
+	Window time.Duration
+	// Rate and Burst limit the alerts sent per second over all sinks.
+	Rate  float64
+	Burst int
+	// QueueSize bounds the alerts waiting for delivery, newer ones are dropped.
+	// It is fixed by the first configuration.
+	QueueSize int
+}
+
+type alerter struct {
+	mu      sync.Mutex
+	cfg     AlertConfig
+	sinks   []AlertSink
+	seen    map[string]*alertGroup
+	limiter *rate.Limiter
+	queue   chan Alert
+	start   sync.Once
+	// level is the alert level while sinks are registered, it is read on the logging path.
+	level int32
+	ready int32
+}
+
+type alertGroup struct {
+	until      time.Time
+	suppressed int
+}
+
+func newAlerter() *alerter {
+	a := &alerter{seen: make(map[string]*alertGroup)}
+	a.configure(AlertConfig{})
+	return a
+}
+
+// RegisterAlertSink adds a sink notified for entries at or above the alert level.
+func RegisterAlertSink(sink AlertSink) {
+	alerts.register(sink)
+}
+
+// ConfigureAlerts replaces the alert settings, zero values keep the defaults.
+func ConfigureAlerts(cfg AlertConfig) {
+	alerts.configure(cfg)
+}
+
+func (a *alerter) register(sink AlertSink) {
+	a.mu.Lock()
+	a.sinks = append(a.sinks, sink)
+	a.mu.Unlock()
+	atomic.StoreInt32(&a.ready, 1)
+	a.start.Do(func() { go a.run() })
+}
+
+func (a *alerter) configure(cfg AlertConfig) {
+	if cfg.Level < zapcore.ErrorLevel {
+		cfg.Level = zapcore.ErrorLevel
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 5 * time.Minute
+	}
+	if cfg.Rate <= 0 {
+		cfg.Rate = 1
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = 10
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cfg = cfg
+	atomic.StoreInt32(&a.level, int32(cfg.Level))
+	a.limiter = rate.NewLimiter(rate.Limit(cfg.Rate), cfg.Burst)
+	if a.queue == nil {
+		a.queue = make(chan Alert, cfg.QueueSize)
+	}
+}
+
+func (a *alerter) enabledFor(l zapcore.Level) bool {
+	return atomic.LoadInt32(&a.ready) == 1 && int32(l) >= atomic.LoadInt32(&a.level)
+}
+
+// fire deduplicates the alert and queues it without blocking.
+func (a *alerter) fire(alert Alert) {
+	a.mu.Lock()
+	now := alert.Time
+	g, ok := a.seen[alert.Fingerprint]
+	if ok && now.Before(g.until) {
+		g.suppressed++
+		a.mu.Unlock()
+		return
+	}
+	if ok {
+		alert.Suppressed = g.suppressed
+	}
+	a.seen[alert.Fingerprint] = &alertGroup{until: now.Add(a.cfg.Window)}
+	for fp, g := range a.seen {
+		if now.After(g.until.Add(a.cfg.Window)) {
+			delete(a.seen, fp)
+		}
+	}
+	allowed := a.limiter.AllowN(now, 1)
+	a.mu.Unlock()
+
+	if !allowed {
+		alertsDropped.WithLabelValues("rate_limited").Inc()
+		return
+	}
+	select {
+	case a.queue <- alert:
+	default:
+		alertsDropped.WithLabelValues("queue_full").Inc()
+	}
+}
+
+func (a *alerter) run() {
+	for alert := range a.queue {
+		a.mu.Lock()
+		sinks := append([]AlertSink(nil), a.sinks...)
+		a.mu.Unlock()
+		for _, s := range sinks {
+			if err := s.Send(alert); err != nil {
+				// not logged through the kit's logger, which could raise another alert.
+				fmt.Fprintf(os.Stderr, "Sending alert %s failed, error: %v\n", alert.Fingerprint, err)
+			}
+		}
+	}
+}
+
+// alertCore raises alerts for the entries it is enabled for, it never writes output.
+type alertCore struct {
+	alerts *alerter
+	fields []zapcore.Field
+}
+
+func (c *alertCore) Enabled(l zapcore.Level) bool {
+	return c.alerts.enabledFor(l)
+}
+
+func (c *alertCore) With(fields []zapcore.Field) zapcore.Core {
+	return &alertCore{alerts: c.alerts, fields: append(append([]zapcore.Field(nil), c.fields...), fields...)}
+}
+
+func (c *alertCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *alertCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range withErrorDetails(fields) {
+		f.AddTo(enc)
+	}
+	caller := ent.Caller.TrimmedPath()
+	c.alerts.fire(Alert{
+		Fingerprint: fingerprint(ent.Message, caller),
+		Service:     viper.GetString("svc_name"),
+		Level:       ent.Level.CapitalString(),
+		Message:     ent.Message,
+		Caller:      caller,
+		Time:        ent.Time,
+		Fields:      enc.Fields,
+		Stack:       ent.Stack,
+	})
+	return nil
+}
+
+func (c *alertCore) Sync() error {
+	return nil
+}
+
+// fingerprint groups alerts by message template and caller.
+func fingerprint(msg, caller string) string {
+	sum := sha1.Sum([]byte(alertDigits.ReplaceAllString(msg, "#") + "\x00" + caller))
+	return hex.EncodeToString(sum[:8])
+}
+
+// configureAlerts applies the log.alerts section and registers the webhook sinks it lists.
+func configureAlerts() {
+	if !viper.GetBool("log.alerts.enable") {
+		return
+	}
+	level := zapcore.ErrorLevel
+	if l := viper.GetString("log.alerts.level"); l != "" {
+		level = getLogLevel(strings.ToLower(l))
+	}
+	ConfigureAlerts(AlertConfig{
+		Level:     level,
+		Window:    time.Duration(viper.GetInt("log.alerts.window")) * time.Second,
+		Rate:      viper.GetFloat64("log.alerts.rate"),
+		Burst:     viper.GetInt("log.alerts.burst"),
+		QueueSize: viper.GetInt("log.alerts.queue_size"),
+	})
+	alertsOnce.Do(func() {
+		if url := viper.GetString("log.alerts.webhook_url"); url != "" {
+			RegisterAlertSink(WebhookSink{URL: url})
+		}
+		if url := viper.GetString("log.alerts.slack_url"); url != "" {
+			RegisterAlertSink(SlackSink{URL: url})
+		}
+	})
+}
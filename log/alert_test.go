@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestAlerts(t *testing.T) {
+	received := make(chan Alert, 10)
+	a := newAlerter()
+	a.configure(AlertConfig{Window: time.Minute, Rate: 100, Burst: 100})
+	a.register(AlertFunc(func(a Alert) { received <- a }))
+	l := zap.New(&alertCore{alerts: a}, zap.AddCaller())
+
+	l.Warn("not an alert")
+	for i := 0; i < 3; i++ {
+		// same template and caller.
+		l.Error("job failed", zap.Int("attempt", i))
+	}
+	for _, id := range []int{42, 43} {
+		l.Sugar().Errorf("job %d failed", id)
+	}
+
+	want := []string{"job failed", "job 42 failed"}
+	for _, msg := range want {
+		select {
+		case a := <-received:
+			if a.Message != msg {
+				t.Errorf("alert message = %v, want %v", a.Message, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("alert %q not received", msg)
+		}
+	}
+	select {
+	case a := <-received:
+		t.Errorf("unexpected alert %v", a.Message)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if fingerprint("job 42 failed", "a.go:1") != fingerprint("job 43 failed", "a.go:1") {
+		t.Errorf("fingerprint differs by digits")
+	}
+	if fingerprint("job failed", "a.go:1") == fingerprint("job failed", "a.go:2") {
+		t.Errorf("fingerprint ignores the caller")
+	}
+}
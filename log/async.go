@@ -0,0 +1,249 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/cauwulixuan/go-kit/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Overflow policies of AsyncWriter.
+const (
+	OverflowBlock      = "block"
+	OverflowDropNewest = "drop_newest"
+	OverflowDropOldest = "drop_oldest"
+)
+
+var asyncDropped = metrics.Factory().NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "log_async",
+	Name:      "entries_dropped_total",
+	Help:      "Number of log entries dropped because the async buffer was full.",
+}, []string{"policy"})
+
+// AsyncWriter is a zapcore.WriteSyncer which queues entries in a bounded
+// ring buffer drained by a single writer goroutine.
+type AsyncWriter struct {
+	ws     zapcore.WriteSyncer
+	policy string
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	idle     *sync.Cond
+	ring     [][]byte
+	head     int
+	count    int
+	inFlight bool
+	closed   bool
+	stopped  chan struct{}
+
+	// writeMu serializes the writer goroutine and WriteSync.
+	writeMu sync.Mutex
+	dropped uint64
+}
+
+// NewAsyncWriter starts draining a buffer of size entries into ws.
+// An unknown policy falls back to OverflowBlock.
+func NewAsyncWriter(ws zapcore.WriteSyncer, size int, policy string) *AsyncWriter {
+	if size <= 0 {
+		size = 1
+	}
+	switch policy {
+	case OverflowDropNewest, OverflowDropOldest:
+	default:
+		policy = OverflowBlock
+	}
+	w := &AsyncWriter{
+		ws:      ws,
+		policy:  policy,
+		ring:    make([][]byte, size),
+		stopped: make(chan struct{}),
+	}
+	w.notEmpty = sync.NewCond(&w.mu)
+	w.notFull = sync.NewCond(&w.mu)
+	w.idle = sync.NewCond(&w.mu)
+	go w.run()
+	return w
+}
+
+// Write queues a copy of p according to the overflow policy.
+// Entries written after Close go straight to the underlying writer.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	buf := make([]byte, len(p))
+	copy(buf, p)
+
+	w.mu.Lock()
+	for w.policy == OverflowBlock && w.count == len(w.ring) && !w.closed {
+		w.notFull.Wait()
+	}
+	if w.closed {
+		w.mu.Unlock()
+		return w.WriteSync(p)
+	}
+	if w.count == len(w.ring) {
+		w.drop()
+		if w.policy == OverflowDropNewest {
+			w.mu.Unlock()
+			return len(p), nil
+		}
+		w.ring[w.head] = nil
+		w.head = (w.head + 1) % len(w.ring)
+		w.count--
+	}
+	w.ring[(w.head+w.count)%len(w.ring)] = buf
+	w.count++
+	w.notEmpty.Signal()
+	w.mu.Unlock()
+	return len(p), nil
+}
+
+// WriteSync drains the buffer and writes p synchronously.
+func (w *AsyncWriter) WriteSync(p []byte) (int, error) {
+	w.wait()
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	n, err := w.ws.Write(p)
+	if err != nil {
+		return n, err
+	}
+	return n, w.ws.Sync()
+}
+
+// Sync blocks until every queued entry is written, then syncs the underlying writer.
+func (w *AsyncWriter) Sync() error {
+	w.wait()
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+	return w.ws.Sync()
+}
+
+// Close drains the buffer and stops the writer goroutine.
+func (w *AsyncWriter) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.notEmpty.Broadcast()
+	w.notFull.Broadcast()
+	w.mu.Unlock()
+	<-w.stopped
+	return w.Sync()
+}
+
+// Dropped returns the number of entries dropped so far.
+func (w *AsyncWriter) Dropped() uint64 {
+	return atomic.LoadUint64(&w.dropped)
+}
+
+// drop counts one dropped entry. w.mu must be held.
+func (w *AsyncWriter) drop() {
+	atomic.AddUint64(&w.dropped, 1)
+	asyncDropped.WithLabelValues(w.policy).Inc()
+}
+
+// wait blocks until the buffer is empty and no write is in flight.
+func (w *AsyncWriter) wait() {
+	w.mu.Lock()
+	for w.count > 0 || w.inFlight {
+		w.idle.Wait()
+	}
+	w.mu.Unlock()
+}
+
+func (w *AsyncWriter) run() {
+	defer close(w.stopped)
+	for {
+		w.mu.Lock()
+		for w.count == 0 && !w.closed {
+			w.notEmpty.Wait()
+		}
+		if w.count == 0 {
+			w.mu.Unlock()
+			return
+		}
+		buf := w.ring[w.head]
+		w.ring[w.head] = nil
+		w.head = (w.head + 1) % len(w.ring)
+		w.count--
+		w.inFlight = true
+		w.notFull.Signal()
+		w.mu.Unlock()
+
+		w.writeMu.Lock()
+		_, _ = w.ws.Write(buf)
+		w.writeMu.Unlock()
+
+		w.mu.Lock()
+		w.inFlight = false
+		if w.count == 0 {
+			w.idle.Broadcast()
+		}
+		w.mu.Unlock()
+	}
+}
+
+// syncWriter writes through AsyncWriter.WriteSync, it is used for entries
+// which must reach the output before the process exits.
+type syncWriter struct {
+	*AsyncWriter
+}
+
+func (w syncWriter) Write(p []byte) (int, error) {
+	return w.WriteSync(p)
+}
+
+// newAsyncCore writes entries up to ErrorLevel through w, and flushes
+// DPanic, Panic and Fatal entries synchronously.
+func newAsyncCore(enc zapcore.Encoder, w *AsyncWriter, enab zapcore.LevelEnabler) zapcore.Core {
+	return zapcore.NewTee(
+		newIOCore(enc, w, zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return l <= zapcore.ErrorLevel && enab.Enabled(l)
+		})),
+		newIOCore(enc.Clone(), syncWriter{w}, zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return l > zapcore.ErrorLevel && enab.Enabled(l)
+		})),
+	)
+}
+
+// AsyncDropped returns the number of entries dropped by the async writers of the global logger.
+func AsyncDropped() uint64 {
+	asyncWritersMu.Lock()
+	defer asyncWritersMu.Unlock()
+	var n uint64
+	for _, w := range asyncWriters {
+		n += w.Dropped()
+	}
+	return n
+}
+
+// closeAsyncWriters drains the async writers of the global logger.
+// Entries written to them afterwards are written synchronously.
+func closeAsyncWriters() {
+	asyncWritersMu.Lock()
+	writers := asyncWriters
+	asyncWriters = nil
+	asyncWritersMu.Unlock()
+	for _, w := range writers {
+		_ = w.Close()
+	}
+}
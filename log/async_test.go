@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// gateWriter blocks every write until the gate is opened.
+type gateWriter struct {
+	gate chan struct{}
+
+	mu    sync.Mutex
+	lines []string
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	<-w.gate
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lines = append(w.lines, string(p))
+	return len(p), nil
+}
+
+func (w *gateWriter) Sync() error {
+	return nil
+}
+
+func (w *gateWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.Join(w.lines, ",")
+}
+
+func TestAsyncWriter(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      string
+		wantDropped uint64
+		want        string
+	}{
+		// "1" is in flight when the buffer fills up, so it is always written.
+		{"DropNewest", OverflowDropNewest, 2, "1,2,3"},
+		{"DropOldest", OverflowDropOldest, 2, "1,4,5"},
+		{"Block", OverflowBlock, 0, "1,2,3,4,5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := &gateWriter{gate: make(chan struct{})}
+			w := NewAsyncWriter(ws, 2, tt.policy)
+			_, _ = w.Write([]byte("1"))
+			waitPicked(w)
+
+			done := make(chan struct{})
+			go func() {
+				for _, l := range []string{"2", "3", "4", "5"} {
+					_, _ = w.Write([]byte(l))
+				}
+				close(done)
+			}()
+			if tt.policy != OverflowBlock {
+				<-done
+			}
+			close(ws.gate)
+			<-done
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			if got := w.Dropped(); got != tt.wantDropped {
+				t.Errorf("Dropped() = %v, want %v", got, tt.wantDropped)
+			}
+			if got := ws.String(); got != tt.want {
+				t.Errorf("written %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAsyncWriterWriteSync(t *testing.T) {
+	ws := &gateWriter{gate: make(chan struct{})}
+	close(ws.gate)
+	w := NewAsyncWriter(ws, 8, OverflowBlock)
+	for _, l := range []string{"1", "2", "3"} {
+		_, _ = w.Write([]byte(l))
+	}
+	if _, err := (syncWriter{w}).Write([]byte("fatal")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if got, want := ws.String(), "1,2,3,fatal"; got != want {
+		t.Errorf("written %v, want %v", got, want)
+	}
+	_ = w.Close()
+}
+
+// waitPicked waits until the writer goroutine picked up every queued entry.
+func waitPicked(w *AsyncWriter) {
+	for {
+		w.mu.Lock()
+		n := w.count
+		w.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		runtime.Gosched()
+	}
+}
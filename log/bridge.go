@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	stdlog "log"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/klog/v2"
+)
+
+var (
+	// restoreStdLog undoes the stdlib log redirection of the previous Init.
+	restoreStdLog func()
+	klogInstalled bool
+	// prevSlogDefault is the slog default logger before log.bridges.slog installed Slog,
+	// and prevStdLog the stdlib log settings slog.SetDefault replaced, which restoring it leaves as they are.
+	prevSlogDefault *slog.Logger
+	prevStdLog      *stdLogSettings
+)
+
+type stdLogSettings struct {
+	out    io.Writer
+	flags  int
+	prefix string
+}
+
+// zapSink is a logr.LogSink writing through a zap logger.
+// V(0) is logged at INFO, V(1) up to maxVerbosity at DEBUG and higher verbosity is dropped.
+type zapSink struct {
+	l            *zap.Logger
+	maxVerbosity int
+}
+
+var (
+	_ logr.LogSink          = &zapSink{}
+	_ logr.CallDepthLogSink = &zapSink{}
+)
+
+// Logr returns a logr.Logger backed by the kit's logger, for klog and controller-style code.
+// Its verbosity is capped by log.bridges.verbosity.
+func Logr() logr.Logger {
+	// logger skips the sink methods like the other wrapper functions.
+	return logr.New(&zapSink{l: logger, maxVerbosity: viper.GetInt("log.bridges.verbosity")})
+}
+
+// baseLogger returns the global logger without the caller skip of the wrapper functions.
+func baseLogger() *zap.Logger {
+	return logger.WithOptions(zap.AddCallerSkip(-1))
+}
+
+func (s *zapSink) Init(info logr.RuntimeInfo) {
+	s.l = s.l.WithOptions(zap.AddCallerSkip(info.CallDepth))
+}
+
+func (s *zapSink) Enabled(level int) bool {
+	return level <= s.maxVerbosity && s.l.Core().Enabled(zapLevelOf(level))
+}
+
+func (s *zapSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	// klog terminates its messages with a newline.
+	if ce := s.l.Check(zapLevelOf(level), strings.TrimSuffix(msg, "\n")); ce != nil {
+		ce.Write(append(fieldsOf(keysAndValues), zap.Int("v", level))...)
+	}
+}
+
+func (s *zapSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	if ce := s.l.Check(zapcore.ErrorLevel, strings.TrimSuffix(msg, "\n")); ce != nil {
+		ce.Write(append(fieldsOf(keysAndValues), zap.Error(err))...)
+	}
+}
+
+func (s *zapSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &zapSink{l: s.l.With(fieldsOf(keysAndValues)...), maxVerbosity: s.maxVerbosity}
+}
+
+func (s *zapSink) WithName(name string) logr.LogSink {
+	return &zapSink{l: s.l.Named(name), maxVerbosity: s.maxVerbosity}
+}
+
+func (s *zapSink) WithCallDepth(depth int) logr.LogSink {
+	return &zapSink{l: s.l.WithOptions(zap.AddCallerSkip(depth)), maxVerbosity: s.maxVerbosity}
+}
+
+func zapLevelOf(verbosity int) zapcore.Level {
+	if verbosity > 0 {
+		return zapcore.DebugLevel
+	}
+	return zapcore.InfoLevel
+}
+
+// fieldsOf converts logr key/value pairs to zap fields.
+func fieldsOf(keysAndValues []interface{}) []zap.Field {
+	fields := make([]zap.Field, 0, len(keysAndValues)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i == len(keysAndValues)-1 {
+			fields = append(fields, zap.Any("ignored", keysAndValues[i]))
+			break
+		}
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		fields = append(fields, zap.Any(key, keysAndValues[i+1]))
+	}
+	return fields
+}
+
+// installBridges routes klog, the slog default logger and the stdlib log package
+// through the global logger if log.bridges.klog, log.bridges.slog and log.bridges.stdlog are set.
+func installBridges() {
+	if restoreStdLog != nil {
+		restoreStdLog()
+		restoreStdLog = nil
+	}
+	if prevSlogDefault != nil {
+		slog.SetDefault(prevSlogDefault)
+		stdlog.SetOutput(prevStdLog.out)
+		stdlog.SetFlags(prevStdLog.flags)
+		stdlog.SetPrefix(prevStdLog.prefix)
+		prevSlogDefault, prevStdLog = nil, nil
+	}
+	if viper.GetBool("log.bridges.slog") {
+		// slog.SetDefault also sends the stdlib log package to Slog,
+		// unless log.bridges.stdlog redirects it below.
+		prevSlogDefault = slog.Default()
+		prevStdLog = &stdLogSettings{out: stdlog.Writer(), flags: stdlog.Flags(), prefix: stdlog.Prefix()}
+		slog.SetDefault(Slog())
+	}
+	if viper.GetBool("log.bridges.stdlog") {
+		restore, err := zap.RedirectStdLogAt(baseLogger(), getLogLevel(viper.GetString("log.bridges.stdlog_level")))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Redirecting stdlib log failed, error: %v\n", err)
+		} else {
+			restoreStdLog = restore
+		}
+	}
+
+	if klogInstalled {
+		klog.ClearLogger()
+		klogInstalled = false
+	}
+	if viper.GetBool("log.bridges.klog") {
+		// klog checks the verbosity itself before calling the logger,
+		// its -v flag of the command line is left as is unless log.bridges.verbosity is set.
+		if viper.IsSet("log.bridges.verbosity") {
+			fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+			klog.InitFlags(fs)
+			_ = fs.Set("v", strconv.Itoa(viper.GetInt("log.bridges.verbosity")))
+		}
+		klog.SetLogger(Logr())
+		klogInstalled = true
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	stdlog "log"
+	"testing"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"k8s.io/klog/v2"
+)
+
+// observeLogger replaces the global logger with one recording its entries until the test ends.
+func observeLogger(t *testing.T) *observer.ObservedLogs {
+	core, observed := observer.New(zapcore.DebugLevel)
+	t.Cleanup(ReplaceLogger(zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1))))
+	return observed
+}
+
+func TestZapLevelOf(t *testing.T) {
+	tests := []struct {
+		verbosity int
+		want      zapcore.Level
+	}{
+		{0, zapcore.InfoLevel},
+		{1, zapcore.DebugLevel},
+		{5, zapcore.DebugLevel},
+	}
+	for _, tt := range tests {
+		if got := zapLevelOf(tt.verbosity); got != tt.want {
+			t.Errorf("zapLevelOf(%v) = %v, want %v", tt.verbosity, got, tt.want)
+		}
+	}
+}
+
+func TestLogr(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("log.bridges.verbosity", 2)
+	observed := observeLogger(t)
+
+	l := Logr()
+	for v, want := range []bool{true, true, true, false} {
+		if got := l.V(v).Enabled(); got != want {
+			t.Errorf("V(%v).Enabled() = %v, want %v", v, got, want)
+		}
+	}
+	l.WithName("ctrl").WithValues("kind", "Pod").V(2).Info("reconciled", "name", "a")
+	l.V(3).Info("dropped")
+	l.Error(errors.New("boom"), "failed")
+
+	entries := observed.TakeAll()
+	if len(entries) != 2 {
+		t.Fatalf("logged %v entries, want 2", len(entries))
+	}
+	e := entries[0]
+	if e.Level != zapcore.DebugLevel || e.LoggerName != "ctrl" || e.Message != "reconciled" {
+		t.Errorf("entry = %v %v %v, want DEBUG ctrl reconciled", e.Level, e.LoggerName, e.Message)
+	}
+	fields := e.ContextMap()
+	if fields["kind"] != "Pod" || fields["name"] != "a" || fields["v"] != int64(2) {
+		t.Errorf("fields = %v, want kind, name and v", fields)
+	}
+	if e := entries[1]; e.Level != zapcore.ErrorLevel || e.ContextMap()["error"] != "boom" {
+		t.Errorf("entry = %v %v, want ERROR with error boom", e.Level, e.ContextMap())
+	}
+}
+
+func TestInstallBridges(t *testing.T) {
+	observed := observeLogger(t)
+	defer func() {
+		viper.Reset()
+		installBridges()
+	}()
+	viper.Set("log.bridges.stdlog", true)
+	viper.Set("log.bridges.stdlog_level", "warn")
+	viper.Set("log.bridges.klog", true)
+	viper.Set("log.bridges.verbosity", 1)
+	installBridges()
+
+	stdlog.Printf("std %d", 1)
+	klog.Info("klog info")
+	klog.V(1).Info("klog v1")
+	klog.V(2).Info("klog v2")
+
+	tests := []struct {
+		msg   string
+		level zapcore.Level
+	}{
+		{"std 1", zapcore.WarnLevel},
+		{"klog info", zapcore.InfoLevel},
+		{"klog v1", zapcore.DebugLevel},
+	}
+	entries := observed.TakeAll()
+	if len(entries) != len(tests) {
+		t.Fatalf("logged %v, want %v entries", entries, len(tests))
+	}
+	for i, tt := range tests {
+		if e := entries[i]; e.Message != tt.msg || e.Level != tt.level {
+			t.Errorf("entry %v = %v %q, want %v %q", i, e.Level, e.Message, tt.level, tt.msg)
+		}
+	}
+}
+
+func TestInstallBridgesUndo(t *testing.T) {
+	observeLogger(t)
+	var buf bytes.Buffer
+	out, flags, prefix := stdlog.Writer(), stdlog.Flags(), stdlog.Prefix()
+	defer func() {
+		viper.Reset()
+		installBridges()
+		stdlog.SetOutput(out)
+		stdlog.SetFlags(flags)
+		stdlog.SetPrefix(prefix)
+		fs := flag.NewFlagSet("klog", flag.ContinueOnError)
+		klog.InitFlags(fs)
+		_ = fs.Set("v", "0")
+	}()
+	stdlog.SetOutput(&buf)
+	stdlog.SetFlags(stdlog.Lshortfile)
+	stdlog.SetPrefix("app: ")
+	viper.Set("log.bridges.slog", true)
+	viper.Set("log.bridges.klog", true)
+	viper.Set("log.bridges.verbosity", 3)
+	installBridges()
+
+	// verbosity is no longer set, the -v flag stays at 3.
+	viper.Reset()
+	viper.Set("log.bridges.klog", true)
+	installBridges()
+	if !klog.V(3).Enabled() {
+		t.Errorf("klog.V(3) disabled, want the -v flag left as is")
+	}
+
+	if stdlog.Writer() != &buf || stdlog.Flags() != stdlog.Lshortfile || stdlog.Prefix() != "app: " {
+		t.Errorf("stdlib log = %v %v %q, want its settings before the slog bridge", stdlog.Writer(), stdlog.Flags(), stdlog.Prefix())
+	}
+}
@@ -0,0 +1,431 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cauwulixuan/go-kit/metrics"
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+)
+
+// Supported collector types.
+const (
+	CollectorLoki          = "loki"
+	CollectorElasticsearch = "elasticsearch"
+)
+
+const (
+	// syncTimeout bounds Sync, zap calls it on Fatal and it must not wait for the retries of a collector which is down.
+	syncTimeout = 2 * time.Second
+	// maxFlushBackoff bounds the wait of the background loop after failed flushes.
+	maxFlushBackoff = time.Minute
+)
+
+var (
+	collectorDelivered = metrics.Factory().NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "log_collector",
+		Name:      "entries_delivered_total",
+		Help:      "Number of log entries delivered to the log collector.",
+	}, []string{"type"})
+	collectorDropped = metrics.Factory().NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "log_collector",
+		Name:      "entries_dropped_total",
+		Help:      "Number of log entries dropped because the buffer was full.",
+	}, []string{"type"})
+	collectorRejected = metrics.Factory().NewCounterVec(prometheus.CounterOpts{
+		Namespace: metrics.Namespace,
+		Subsystem: "log_collector",
+		Name:      "entries_rejected_total",
+		Help:      "Number of log entries dropped because the log collector rejected them with a 4xx.",
+	}, []string{"type"})
+)
+
+// CollectorConfig describes where and how log entries are shipped.
+type CollectorConfig struct {
+	// Type is one of CollectorLoki or CollectorElasticsearch.
+	Type string
+	// URL is the Loki push endpoint or the Elasticsearch _bulk endpoint.
+	URL string
+	// Labels are attached to the Loki stream.
+	Labels map[string]string
+	// Index is the Elasticsearch target index.
+	Index string
+	// BatchSize is the max number of entries per request.
+	BatchSize int
+	// BatchBytes is the max uncompressed payload size per request.
+	BatchBytes int
+	// FlushInterval sends a partial batch once it is reached.
+	FlushInterval time.Duration
+	// BufferSize bounds the number of pending entries, the oldest are dropped first.
+	BufferSize int
+	// Compress gzips the request payload.
+	Compress bool
+	// ShutdownTimeout bounds the final flush of Close.
+	ShutdownTimeout time.Duration
+	// Client sends the batches, the client set by SetCollectorClient is used if nil.
+	Client *resty.Client
+}
+
+type collectorEntry struct {
+	time time.Time
+	line []byte
+}
+
+// Collector is a zapcore.WriteSyncer which batches encoded entries
+// and pushes them to a remote log collector.
+type Collector struct {
+	cfg CollectorConfig
+
+	mu      sync.Mutex
+	pending []collectorEntry
+
+	// batchSize is BatchSize, halved whenever the collector responds 413. failures and retryAt
+	// back off the background loop after failed flushes. They are guarded by sendMu.
+	batchSize int
+	failures  int
+	retryAt   time.Time
+
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+	sendMu  sync.Mutex
+}
+
+// NewCollector starts a collector which ships entries in the background.
+func NewCollector(cfg CollectorConfig) (*Collector, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("log collector url is empty")
+	}
+	switch cfg.Type {
+	case "", CollectorLoki:
+		cfg.Type = CollectorLoki
+	case CollectorElasticsearch:
+		if cfg.Index == "" {
+			return nil, fmt.Errorf("log collector index is empty")
+		}
+	default:
+		return nil, fmt.Errorf("unknown log collector type %q", cfg.Type)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 1000
+	}
+	if cfg.BatchBytes <= 0 {
+		cfg.BatchBytes = 1 << 20
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10 * cfg.BatchSize
+	}
+	if cfg.BufferSize < cfg.BatchSize {
+		cfg.BufferSize = cfg.BatchSize
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		cfg.ShutdownTimeout = 5 * time.Second
+	}
+	c := &Collector{
+		cfg:       cfg,
+		batchSize: cfg.BatchSize,
+		kick:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go c.run()
+	return c, nil
+}
+
+var (
+	collectorClientMu sync.RWMutex
+	collectorClient   = func() *resty.Client {
+		return resty.New().SetTimeout(time.Duration(viper.GetInt("http.timeout")) * time.Second)
+	}
+)
+
+// SetCollectorClient sets the client of the collectors without CollectorConfig.Client, it is called for every batch.
+// The http package sets its client of http.clients.collector, so the timeout, retries and TLS settings are shared,
+// the batches are sent without retries if it is not linked.
+func SetCollectorClient(client func() *resty.Client) {
+	collectorClientMu.Lock()
+	defer collectorClientMu.Unlock()
+	collectorClient = client
+}
+
+func (c *Collector) client() *resty.Client {
+	if c.cfg.Client != nil {
+		return c.cfg.Client
+	}
+	collectorClientMu.RLock()
+	defer collectorClientMu.RUnlock()
+	return collectorClient()
+}
+
+// Write queues one encoded entry, zap calls it once per entry.
+func (c *Collector) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	c.mu.Lock()
+	c.push(collectorEntry{time: time.Now(), line: bytes.TrimRight(line, "\n")})
+	full := len(c.pending) >= c.cfg.BatchSize
+	c.mu.Unlock()
+
+	if full {
+		c.wake()
+	}
+	return len(p), nil
+}
+
+// Sync sends the pending entries within syncTimeout, what fails is left to the retries of the background loop.
+// If the loop is sending already, Sync only wakes it up.
+func (c *Collector) Sync() error {
+	if !c.sendMu.TryLock() {
+		c.wake()
+		return nil
+	}
+	defer c.sendMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	return c.flush(ctx)
+}
+
+// Close stops the background loop after a final flush bounded by ShutdownTimeout.
+func (c *Collector) Close() error {
+	c.once.Do(func() { close(c.done) })
+	<-c.stopped
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.ShutdownTimeout)
+	defer cancel()
+	return c.flush(ctx)
+}
+
+func (c *Collector) wake() {
+	select {
+	case c.kick <- struct{}{}:
+	default:
+	}
+}
+
+// push appends entries, dropping the oldest ones once BufferSize is exceeded.
+// c.mu must be held.
+func (c *Collector) push(entries ...collectorEntry) {
+	c.pending = append(c.pending, entries...)
+	if over := len(c.pending) - c.cfg.BufferSize; over > 0 {
+		c.pending = append(c.pending[:0], c.pending[over:]...)
+		collectorDropped.WithLabelValues(c.cfg.Type).Add(float64(over))
+	}
+}
+
+func (c *Collector) run() {
+	defer close(c.stopped)
+	ticker := time.NewTicker(c.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		case <-c.kick:
+		}
+		c.sendMu.Lock()
+		if !time.Now().Before(c.retryAt) {
+			_ = c.flush(context.Background())
+		}
+		c.sendMu.Unlock()
+	}
+}
+
+// collectorStatusError is the error status a log collector responded with.
+type collectorStatusError struct {
+	status int
+}
+
+func (e *collectorStatusError) Error() string {
+	return fmt.Sprintf("log collector responded with status code %d", e.status)
+}
+
+// permanent reports whether the batch would be rejected again.
+func (e *collectorStatusError) permanent() bool {
+	return e.status >= http.StatusBadRequest && e.status < http.StatusInternalServerError &&
+		e.status != http.StatusRequestTimeout && e.status != http.StatusTooManyRequests
+}
+
+// flush sends batches until the buffer is empty or a request fails. A batch too large for the collector
+// is sent again in halves, one it rejects otherwise is dropped. Batches failing for other reasons are
+// put back in front of the buffer, and the background loop backs off. c.sendMu must be held.
+func (c *Collector) flush(ctx context.Context) error {
+	var rejected error
+	for {
+		batch := c.take()
+		if len(batch) == 0 {
+			return rejected
+		}
+		err := c.send(ctx, batch)
+		var statusErr *collectorStatusError
+		switch {
+		case err == nil:
+			c.failures, c.retryAt = 0, time.Time{}
+			collectorDelivered.WithLabelValues(c.cfg.Type).Add(float64(len(batch)))
+		case errors.As(err, &statusErr) && statusErr.status == http.StatusRequestEntityTooLarge && len(batch) > 1:
+			c.batchSize = len(batch) / 2
+			c.requeue(batch)
+		case errors.As(err, &statusErr) && statusErr.permanent():
+			rejected = err
+			collectorRejected.WithLabelValues(c.cfg.Type).Add(float64(len(batch)))
+		default:
+			c.requeue(batch)
+			c.failures++
+			backoff := maxFlushBackoff
+			if c.failures <= 6 {
+				backoff = time.Second << (c.failures - 1)
+			}
+			c.retryAt = time.Now().Add(backoff)
+			return err
+		}
+	}
+}
+
+// requeue puts batch back in front of the buffer.
+func (c *Collector) requeue(batch []collectorEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	rest := c.pending
+	c.pending = nil
+	c.push(append(batch, rest...)...)
+}
+
+// take removes the next batch from the buffer, bounded by batchSize and BatchBytes. c.sendMu must be held.
+func (c *Collector) take() []collectorEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n, size := 0, 0
+	for n < len(c.pending) && n < c.batchSize {
+		size += len(c.pending[n].line)
+		if n > 0 && size > c.cfg.BatchBytes {
+			break
+		}
+		n++
+	}
+	batch := make([]collectorEntry, n)
+	copy(batch, c.pending[:n])
+	c.pending = append(c.pending[:0], c.pending[n:]...)
+	return batch
+}
+
+func (c *Collector) send(ctx context.Context, batch []collectorEntry) error {
+	var (
+		body        []byte
+		contentType string
+		err         error
+	)
+	switch c.cfg.Type {
+	case CollectorElasticsearch:
+		body, contentType = c.bulkPayload(batch), "application/x-ndjson"
+	default:
+		body, err = c.lokiPayload(batch)
+		contentType = "application/json"
+	}
+	if err != nil {
+		return err
+	}
+
+	req := c.client().R().SetContext(ctx).SetHeader("Content-Type", contentType)
+	if c.cfg.Compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+		req.SetHeader("Content-Encoding", "gzip")
+	}
+
+	resp, err := req.SetBody(body).Post(c.cfg.URL)
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return &collectorStatusError{status: resp.StatusCode()}
+	}
+	return nil
+}
+
+// lokiPayload builds a Loki push request with a single stream.
+func (c *Collector) lokiPayload(batch []collectorEntry) ([]byte, error) {
+	values := make([][2]string, 0, len(batch))
+	for _, e := range batch {
+		values = append(values, [2]string{strconv.FormatInt(e.time.UnixNano(), 10), string(e.line)})
+	}
+	labels := c.cfg.Labels
+	if len(labels) == 0 {
+		labels = map[string]string{"service_name": viper.GetString("svc_name")}
+	}
+	return json.Marshal(map[string]interface{}{
+		"streams": []interface{}{
+			map[string]interface{}{"stream": labels, "values": values},
+		},
+	})
+}
+
+// bulkPayload builds an Elasticsearch _bulk request indexing every entry.
+func (c *Collector) bulkPayload(batch []collectorEntry) []byte {
+	action := fmt.Sprintf(`{"index":{"_index":%q}}`, c.cfg.Index)
+	var buf bytes.Buffer
+	for _, e := range batch {
+		buf.WriteString(action)
+		buf.WriteByte('\n')
+		buf.Write(e.line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func getCollectorConfig() CollectorConfig {
+	return CollectorConfig{
+		Type:            viper.GetString("log.collector.type"),
+		URL:             viper.GetString("log.collector.url"),
+		Labels:          viper.GetStringMapString("log.collector.labels"),
+		Index:           viper.GetString("log.collector.index"),
+		BatchSize:       viper.GetInt("log.collector.batch_size"),
+		BatchBytes:      viper.GetInt("log.collector.batch_bytes"),
+		FlushInterval:   time.Duration(viper.GetInt("log.collector.flush_interval")) * time.Second,
+		BufferSize:      viper.GetInt("log.collector.buffer_size"),
+		Compress:        viper.GetBool("log.collector.compress"),
+		ShutdownTimeout: time.Duration(viper.GetInt("log.collector.shutdown_timeout")) * time.Second,
+	}
+}
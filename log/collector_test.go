@@ -0,0 +1,277 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type collectorServer struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	status int
+	lines  []string
+}
+
+func newCollectorServer(t *testing.T, parse func(r io.Reader) []string) *collectorServer {
+	s := &collectorServer{status: http.StatusNoContent}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Errorf("gzip.NewReader() error = %v", err)
+				return
+			}
+			body = zr
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.status < http.StatusBadRequest {
+			s.lines = append(s.lines, parse(body)...)
+		}
+		w.WriteHeader(s.status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *collectorServer) setStatus(status int) {
+	s.mu.Lock()
+	s.status = status
+	s.mu.Unlock()
+}
+
+func (s *collectorServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.lines...)
+}
+
+func parseLoki(r io.Reader) []string {
+	var req struct {
+		Streams []struct {
+			Values [][2]string `json:"values"`
+		} `json:"streams"`
+	}
+	_ = json.NewDecoder(r).Decode(&req)
+	var lines []string
+	for _, s := range req.Streams {
+		for _, v := range s.Values {
+			lines = append(lines, v[1])
+		}
+	}
+	return lines
+}
+
+func parseBulk(r io.Reader) []string {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	for i := 0; sc.Scan(); i++ {
+		if i%2 == 1 {
+			lines = append(lines, sc.Text())
+		}
+	}
+	return lines
+}
+
+func TestCollector(t *testing.T) {
+	tests := []struct {
+		name  string
+		typ   string
+		parse func(r io.Reader) []string
+	}{
+		{"Loki", CollectorLoki, parseLoki},
+		{"Elasticsearch", CollectorElasticsearch, parseBulk},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newCollectorServer(t, tt.parse)
+			c, err := NewCollector(CollectorConfig{
+				Type:          tt.typ,
+				URL:           srv.URL,
+				Index:         "test",
+				BatchSize:     2,
+				FlushInterval: time.Hour,
+				Compress:      true,
+				Client:        resty.New(),
+			})
+			if err != nil {
+				t.Fatalf("NewCollector() error = %v", err)
+			}
+			for _, l := range []string{`{"msg":"a"}`, `{"msg":"b"}`, `{"msg":"c"}`} {
+				_, _ = c.Write([]byte(l + "\n"))
+			}
+			if err := c.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			got := strings.Join(srv.received(), ",")
+			if want := `{"msg":"a"},{"msg":"b"},{"msg":"c"}`; got != want {
+				t.Errorf("received %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestCollectorDropOldest(t *testing.T) {
+	srv := newCollectorServer(t, parseLoki)
+	srv.setStatus(http.StatusServiceUnavailable)
+	c, err := NewCollector(CollectorConfig{
+		URL:           srv.URL,
+		BatchSize:     2,
+		BufferSize:    3,
+		FlushInterval: time.Hour,
+		Client:        resty.New(),
+	})
+	if err != nil {
+		t.Fatalf("NewCollector() error = %v", err)
+	}
+	dropped := testutil.ToFloat64(collectorDropped.WithLabelValues(CollectorLoki))
+	for _, l := range []string{"1", "2", "3", "4", "5"} {
+		_, _ = c.Write([]byte(l))
+	}
+	if err := c.Sync(); err == nil {
+		t.Errorf("Sync() error = nil, want error while collector is down")
+	}
+	if got := testutil.ToFloat64(collectorDropped.WithLabelValues(CollectorLoki)) - dropped; got != 2 {
+		t.Errorf("dropped = %v, want 2", got)
+	}
+
+	srv.setStatus(http.StatusNoContent)
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := strings.Join(srv.received(), ","); got != "3,4,5" {
+		t.Errorf("received %v, want 3,4,5", got)
+	}
+}
+
+func TestCollectorSyncBounded(t *testing.T) {
+	srv := newCollectorServer(t, parseLoki)
+	srv.setStatus(http.StatusServiceUnavailable)
+	retried := 0
+	prev := collectorClient
+	defer SetCollectorClient(prev)
+	SetCollectorClient(func() *resty.Client {
+		return resty.New().SetRetryCount(3).SetRetryWaitTime(time.Minute).SetRetryMaxWaitTime(time.Minute).
+			AddRetryCondition(func(*resty.Response, error) bool {
+				retried++
+				return true
+			})
+	})
+	c, err := NewCollector(CollectorConfig{URL: srv.URL, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatalf("NewCollector() error = %v", err)
+	}
+	_, _ = c.Write([]byte("1"))
+
+	start := time.Now()
+	if err := c.Sync(); err == nil {
+		t.Errorf("Sync() error = nil, want error while collector is down")
+	}
+	if elapsed := time.Since(start); elapsed > syncTimeout+time.Second {
+		t.Errorf("Sync() took %v, want it bounded by %v", elapsed, syncTimeout)
+	}
+	if retried != 1 {
+		t.Errorf("attempts = %v, want the one of the client set by SetCollectorClient", retried)
+	}
+
+	srv.setStatus(http.StatusNoContent)
+	SetCollectorClient(func() *resty.Client { return resty.New() })
+	if err := c.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := strings.Join(srv.received(), ","); got != "1" {
+		t.Errorf("received %v, want 1", got)
+	}
+}
+
+func TestCollectorRejected(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lines := parseLoki(r.Body)
+		switch {
+		case len(lines) > 2:
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+		case strings.Contains(strings.Join(lines, ","), "bad"):
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			mu.Lock()
+			received = append(received, lines...)
+			mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer srv.Close()
+	c, err := NewCollector(CollectorConfig{URL: srv.URL, BatchSize: 8, FlushInterval: time.Hour, Client: resty.New()})
+	if err != nil {
+		t.Fatalf("NewCollector() error = %v", err)
+	}
+	rejected := testutil.ToFloat64(collectorRejected.WithLabelValues(CollectorLoki))
+	for _, l := range []string{"1", "2", "bad", "3", "4", "5"} {
+		_, _ = c.Write([]byte(l))
+	}
+	if err := c.Close(); err == nil {
+		t.Errorf("Close() error = nil, want the rejection")
+	}
+	// 6 and then 3 entries are too large, so they are sent one by one from then on.
+	if got := strings.Join(received, ","); got != "1,2,3,4,5" {
+		t.Errorf("received %v, want 1,2,3,4,5", got)
+	}
+	if got := testutil.ToFloat64(collectorRejected.WithLabelValues(CollectorLoki)) - rejected; got != 1 {
+		t.Errorf("rejected = %v, want the bad entry", got)
+	}
+}
+
+func TestCollectorBackoff(t *testing.T) {
+	srv := newCollectorServer(t, parseLoki)
+	srv.setStatus(http.StatusServiceUnavailable)
+	c, err := NewCollector(CollectorConfig{URL: srv.URL, FlushInterval: time.Hour, ShutdownTimeout: 100 * time.Millisecond, Client: resty.New()})
+	if err != nil {
+		t.Fatalf("NewCollector() error = %v", err)
+	}
+	defer c.Close()
+	_, _ = c.Write([]byte("1"))
+	for i := 1; i <= 2; i++ {
+		c.sendMu.Lock()
+		_ = c.flush(context.Background())
+		wait := time.Until(c.retryAt)
+		c.sendMu.Unlock()
+		if want := time.Duration(i) * time.Second; wait <= want-100*time.Millisecond || wait > want {
+			t.Errorf("backoff after %d failed flushes = %v, want %v", i, wait, want)
+		}
+	}
+}
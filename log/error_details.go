@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// errorDetailsCore adds a "<key>Details" object field next to every error field
+// whose error implements zapcore.ObjectMarshaler, such as the kit's errors.Error.
+// zap.Error itself only encodes the message.
+type errorDetailsCore struct {
+	zapcore.Core
+}
+
+// newIOCore is zapcore.NewCore with error details.
+func newIOCore(enc zapcore.Encoder, ws zapcore.WriteSyncer, enab zapcore.LevelEnabler) zapcore.Core {
+	return errorDetailsCore{zapcore.NewCore(enc, ws, enab)}
+}
+
+func (c errorDetailsCore) With(fields []zapcore.Field) zapcore.Core {
+	return errorDetailsCore{c.Core.With(withErrorDetails(fields))}
+}
+
+func (c errorDetailsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c errorDetailsCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, withErrorDetails(fields))
+}
+
+func withErrorDetails(fields []zapcore.Field) []zapcore.Field {
+	var result []zapcore.Field
+	for i, f := range fields {
+		om, ok := f.Interface.(zapcore.ObjectMarshaler)
+		if f.Type != zapcore.ErrorType || !ok {
+			if result != nil {
+				result = append(result, f)
+			}
+			continue
+		}
+		if result == nil {
+			result = append(make([]zapcore.Field, 0, len(fields)+1), fields[:i]...)
+		}
+		result = append(result, f, zap.Object(f.Key+"Details", om))
+	}
+	if result == nil {
+		return fields
+	}
+	return result
+}
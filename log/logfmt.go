@@ -0,0 +1,308 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+package log
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+var logfmtPool = buffer.NewPool()
+
+// logfmtEncoder writes entries as key=value pairs separated by spaces.
+// Objects and namespaces are flattened into dotted keys, arrays and reflected values are encoded as JSON.
+type logfmtEncoder struct {
+	*zapcore.EncoderConfig
+	buf *buffer.Buffer
+	// prefix of the keys of the open objects and namespaces.
+	prefix string
+}
+
+// NewLogfmtEncoder returns a logfmt encoder using the keys and encoders of cfg.
+func NewLogfmtEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	return &logfmtEncoder{EncoderConfig: &cfg, buf: logfmtPool.Get()}
+}
+
+func (enc *logfmtEncoder) addKey(key string) {
+	if enc.buf.Len() > 0 {
+		enc.buf.AppendByte(' ')
+	}
+	// keys end at the first space or =.
+	enc.buf.AppendString(strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError {
+			return '_'
+		}
+		return r
+	}, enc.prefix+key))
+	enc.buf.AppendByte('=')
+}
+
+// appendValue quotes s if it is empty or holds spaces, quotes, = or control characters.
+func (enc *logfmtEncoder) appendValue(s string) {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r <= ' ' || r == '=' || r == '"' || r == '\\' || r == utf8.RuneError || r == 0x7f
+	}) >= 0 {
+		enc.buf.AppendString(strconv.Quote(s))
+		return
+	}
+	enc.buf.AppendString(s)
+}
+
+func (enc *logfmtEncoder) add(key, value string) {
+	enc.addKey(key)
+	enc.appendValue(value)
+}
+
+func (enc *logfmtEncoder) addJSON(key string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	enc.add(key, string(b))
+	return nil
+}
+
+func (enc *logfmtEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	m := zapcore.NewMapObjectEncoder()
+	if err := m.AddArray(key, arr); err != nil {
+		return err
+	}
+	return enc.addJSON(key, m.Fields[key])
+}
+
+func (enc *logfmtEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	prefix := enc.prefix
+	enc.prefix += key + "."
+	err := obj.MarshalLogObject(enc)
+	enc.prefix = prefix
+	return err
+}
+
+func (enc *logfmtEncoder) AddBinary(key string, value []byte) {
+	enc.add(key, base64.StdEncoding.EncodeToString(value))
+}
+
+func (enc *logfmtEncoder) AddByteString(key string, value []byte) {
+	enc.add(key, string(value))
+}
+
+func (enc *logfmtEncoder) AddBool(key string, value bool) {
+	enc.add(key, strconv.FormatBool(value))
+}
+
+func (enc *logfmtEncoder) AddComplex128(key string, value complex128) {
+	enc.add(key, strconv.FormatComplex(value, 'g', -1, 128))
+}
+
+func (enc *logfmtEncoder) AddComplex64(key string, value complex64) {
+	enc.add(key, strconv.FormatComplex(complex128(value), 'g', -1, 64))
+}
+
+func (enc *logfmtEncoder) AddDuration(key string, value time.Duration) {
+	if enc.EncodeDuration == nil {
+		enc.AddInt64(key, int64(value))
+		return
+	}
+	var c valueCapture
+	enc.EncodeDuration(value, &c)
+	enc.add(key, c.String())
+}
+
+func (enc *logfmtEncoder) AddFloat64(key string, value float64) {
+	enc.add(key, formatFloat(value, 64))
+}
+
+func (enc *logfmtEncoder) AddFloat32(key string, value float32) {
+	enc.add(key, formatFloat(float64(value), 32))
+}
+
+func formatFloat(f float64, bitSize int) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, bitSize)
+}
+
+func (enc *logfmtEncoder) AddInt(key string, value int)     { enc.AddInt64(key, int64(value)) }
+func (enc *logfmtEncoder) AddInt32(key string, value int32) { enc.AddInt64(key, int64(value)) }
+func (enc *logfmtEncoder) AddInt16(key string, value int16) { enc.AddInt64(key, int64(value)) }
+func (enc *logfmtEncoder) AddInt8(key string, value int8)   { enc.AddInt64(key, int64(value)) }
+
+func (enc *logfmtEncoder) AddInt64(key string, value int64) {
+	enc.add(key, strconv.FormatInt(value, 10))
+}
+
+func (enc *logfmtEncoder) AddString(key, value string) {
+	enc.add(key, value)
+}
+
+func (enc *logfmtEncoder) AddTime(key string, value time.Time) {
+	if enc.EncodeTime == nil {
+		enc.AddInt64(key, value.UnixNano())
+		return
+	}
+	var c valueCapture
+	enc.EncodeTime(value, &c)
+	enc.add(key, c.String())
+}
+
+func (enc *logfmtEncoder) AddUint(key string, value uint)       { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUint32(key string, value uint32)   { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUint16(key string, value uint16)   { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUint8(key string, value uint8)     { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUintptr(key string, value uintptr) { enc.AddUint64(key, uint64(value)) }
+
+func (enc *logfmtEncoder) AddUint64(key string, value uint64) {
+	enc.add(key, strconv.FormatUint(value, 10))
+}
+
+func (enc *logfmtEncoder) AddReflected(key string, value interface{}) error {
+	return enc.addJSON(key, value)
+}
+
+func (enc *logfmtEncoder) OpenNamespace(key string) {
+	enc.prefix += key + "."
+}
+
+func (enc *logfmtEncoder) Clone() zapcore.Encoder {
+	clone := &logfmtEncoder{EncoderConfig: enc.EncoderConfig, buf: logfmtPool.Get(), prefix: enc.prefix}
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	final := &logfmtEncoder{EncoderConfig: enc.EncoderConfig, buf: logfmtPool.Get()}
+
+	if final.TimeKey != "" && final.EncodeTime != nil {
+		final.AddTime(final.TimeKey, ent.Time)
+	}
+	if final.LevelKey != "" && final.EncodeLevel != nil {
+		var c valueCapture
+		final.EncodeLevel(ent.Level, &c)
+		// not quoted, so that colored levels stay colored.
+		final.addKey(final.LevelKey)
+		final.buf.AppendString(c.String())
+	}
+	if final.NameKey != "" && ent.LoggerName != "" {
+		final.encodeWith(final.NameKey, ent.LoggerName, func(c *valueCapture) {
+			if final.EncodeName != nil {
+				final.EncodeName(ent.LoggerName, c)
+			}
+		})
+	}
+	if ent.Caller.Defined {
+		if final.CallerKey != "" {
+			final.encodeWith(final.CallerKey, ent.Caller.String(), func(c *valueCapture) {
+				if final.EncodeCaller != nil {
+					final.EncodeCaller(ent.Caller, c)
+				}
+			})
+		}
+		if final.FunctionKey != "" {
+			final.add(final.FunctionKey, ent.Caller.Function)
+		}
+	}
+	if final.MessageKey != "" {
+		final.add(final.MessageKey, ent.Message)
+	}
+
+	// fields added by With, encoded under their namespaces already.
+	if enc.buf.Len() > 0 {
+		if final.buf.Len() > 0 {
+			final.buf.AppendByte(' ')
+		}
+		final.buf.Write(enc.buf.Bytes())
+	}
+	final.prefix = enc.prefix
+	for _, f := range fields {
+		f.AddTo(final)
+	}
+	final.prefix = ""
+
+	if ent.Stack != "" && final.StacktraceKey != "" {
+		final.add(final.StacktraceKey, ent.Stack)
+	}
+	if final.LineEnding != "" {
+		final.buf.AppendString(final.LineEnding)
+	} else {
+		final.buf.AppendString(zapcore.DefaultLineEnding)
+	}
+	return final.buf, nil
+}
+
+// encodeWith adds key with the value written by encode, or fallback if it writes none.
+func (enc *logfmtEncoder) encodeWith(key, fallback string, encode func(c *valueCapture)) {
+	var c valueCapture
+	encode(&c)
+	if len(c.values) == 0 {
+		enc.add(key, fallback)
+		return
+	}
+	enc.add(key, c.String())
+}
+
+// valueCapture collects the values written by the time, level, duration, name and caller encoders.
+type valueCapture struct {
+	values []string
+}
+
+var _ zapcore.PrimitiveArrayEncoder = &valueCapture{}
+
+func (c *valueCapture) String() string {
+	return strings.Join(c.values, ",")
+}
+
+func (c *valueCapture) append(s string) {
+	c.values = append(c.values, s)
+}
+
+func (c *valueCapture) AppendBool(v bool)         { c.append(strconv.FormatBool(v)) }
+func (c *valueCapture) AppendByteString(v []byte) { c.append(string(v)) }
+func (c *valueCapture) AppendComplex128(v complex128) {
+	c.append(strconv.FormatComplex(v, 'g', -1, 128))
+}
+func (c *valueCapture) AppendComplex64(v complex64) {
+	c.append(strconv.FormatComplex(complex128(v), 'g', -1, 64))
+}
+func (c *valueCapture) AppendFloat64(v float64) { c.append(formatFloat(v, 64)) }
+func (c *valueCapture) AppendFloat32(v float32) { c.append(formatFloat(float64(v), 32)) }
+func (c *valueCapture) AppendInt(v int)         { c.append(strconv.Itoa(v)) }
+func (c *valueCapture) AppendInt64(v int64)     { c.append(strconv.FormatInt(v, 10)) }
+func (c *valueCapture) AppendInt32(v int32)     { c.append(strconv.FormatInt(int64(v), 10)) }
+func (c *valueCapture) AppendInt16(v int16)     { c.append(strconv.FormatInt(int64(v), 10)) }
+func (c *valueCapture) AppendInt8(v int8)       { c.append(strconv.FormatInt(int64(v), 10)) }
+func (c *valueCapture) AppendString(v string)   { c.append(v) }
+func (c *valueCapture) AppendUint(v uint)       { c.append(strconv.FormatUint(uint64(v), 10)) }
+func (c *valueCapture) AppendUint64(v uint64)   { c.append(strconv.FormatUint(v, 10)) }
+func (c *valueCapture) AppendUint32(v uint32)   { c.append(strconv.FormatUint(uint64(v), 10)) }
+func (c *valueCapture) AppendUint16(v uint16)   { c.append(strconv.FormatUint(uint64(v), 10)) }
+func (c *valueCapture) AppendUint8(v uint8)     { c.append(strconv.FormatUint(uint64(v), 10)) }
+func (c *valueCapture) AppendUintptr(v uintptr) { c.append(strconv.FormatUint(uint64(v), 10)) }
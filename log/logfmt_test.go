@@ -0,0 +1,129 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+package log
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogfmtEncoder(t *testing.T) {
+	ent := zapcore.Entry{
+		Level:      zapcore.WarnLevel,
+		Time:       time.Date(2026, 10, 18, 8, 0, 0, 0, time.UTC),
+		LoggerName: "http",
+		Message:    "request failed",
+		Caller:     zapcore.NewEntryCaller(0, "/src/go-kit/http/client.go", 42, true),
+	}
+	cfg := zapcore.EncoderConfig{
+		TimeKey:      "time",
+		LevelKey:     "level",
+		NameKey:      "logger",
+		CallerKey:    "caller",
+		MessageKey:   "msg",
+		EncodeTime:   zapcore.RFC3339TimeEncoder,
+		EncodeLevel:  zapcore.LowercaseLevelEncoder,
+		EncodeCaller: zapcore.ShortCallerEncoder,
+		EncodeName:   zapcore.FullNameEncoder,
+		// durations are nanoseconds without an encoder.
+		EncodeDuration: zapcore.StringDurationEncoder,
+	}
+	prefix := `time=2026-10-18T08:00:00Z level=warn logger=http caller=http/client.go:42 msg="request failed"`
+
+	tests := []struct {
+		name   string
+		with   []zap.Field
+		fields []zap.Field
+		want   string
+	}{
+		{"NoFields", nil, nil, prefix + "\n"},
+		{"Scalars", nil, []zap.Field{zap.Int("status", 503), zap.Bool("retry", true), zap.Duration("took", 1500*time.Millisecond)},
+			prefix + " status=503 retry=true took=1.5s\n"},
+		{"Quoted", nil, []zap.Field{zap.String("q", `a "b"`), zap.String("empty", ""), zap.Error(errors.New("x=1"))},
+			prefix + ` q="a \"b\"" empty="" error="x=1"` + "\n"},
+		{"Object", nil, []zap.Field{zap.Object("req", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+			enc.AddString("method", "GET")
+			return nil
+		})), zap.Int("n", 1)}, prefix + " req.method=GET n=1\n"},
+		{"Array", nil, []zap.Field{zap.Ints("ids", []int{1, 2})}, prefix + " ids=[1,2]\n"},
+		{"WithNamespace", []zap.Field{zap.String("svc", "a"), zap.Namespace("job")}, []zap.Field{zap.Int("id", 7)},
+			prefix + " svc=a job.id=7\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc := NewLogfmtEncoder(cfg)
+			for _, f := range tt.with {
+				f.AddTo(enc)
+			}
+			buf, err := enc.EncodeEntry(ent, tt.fields)
+			if err != nil {
+				t.Fatalf("EncodeEntry() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("EncodeEntry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomEncoderConfig(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("log.time_format", "rfc3339")
+	viper.Set("log.time_zone", "Asia/Shanghai")
+	viper.Set("log.caller", "off")
+	viper.Set("log.keys.message", "message")
+	viper.Set("log.format", "logfmt")
+
+	ent := zapcore.Entry{
+		Level:   zapcore.InfoLevel,
+		Time:    time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC),
+		Message: "hello",
+		Caller:  zapcore.NewEntryCaller(0, "/src/main.go", 1, true),
+	}
+	buf, err := newEncoder("json", false).EncodeEntry(ent, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "time=2026-10-18T08:00:00+08:00 level=INFO message=hello\n"
+	if got := buf.String(); got != want {
+		t.Errorf("EncodeEntry() = %v, want %v", got, want)
+	}
+}
+
+func TestNewEncoderColor(t *testing.T) {
+	defer viper.Reset()
+	viper.Set("log.level_format", "capital_color")
+	viper.Set("log.format", "console")
+
+	ent := zapcore.Entry{Level: zapcore.WarnLevel, Message: "hello"}
+	for _, color := range []bool{false, true} {
+		buf, err := newEncoder("console", color).EncodeEntry(ent, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(buf.String(), "\x1b["); got != color {
+			t.Errorf("newEncoder(color %v) = %q, colored %v", color, buf.String(), got)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+// Package logtest captures the output of the kit's logger in memory, so tests can assert on it.
+//
+//	func TestSomething(t *testing.T) {
+//		logs := logtest.New(t)
+//		doSomething()
+//		logs.AssertContains(zap.InfoLevel, "done", zap.Int("count", 1))
+//		logs.AssertNoErrors()
+//	}
+package logtest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/cauwulixuan/go-kit/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// Logs holds the entries logged since New.
+type Logs struct {
+	t        testing.TB
+	observed *observer.ObservedLogs
+}
+
+type options struct {
+	level  zapcore.Level
+	mirror bool
+}
+
+// Option configures New.
+type Option func(*options)
+
+// WithLevel captures entries at or above level, the default is DEBUG.
+func WithLevel(level zapcore.Level) Option {
+	return func(o *options) {
+		o.level = level
+	}
+}
+
+// WithMirror also writes every captured entry to t.Log.
+func WithMirror() Option {
+	return func(o *options) {
+		o.mirror = true
+	}
+}
+
+// New replaces the kit's global logger with an in-memory one,
+// the previous logger is restored on t.Cleanup.
+// Fatal entries stop the calling goroutine with runtime.Goexit instead of exiting the process.
+func New(t testing.TB, opts ...Option) *Logs {
+	t.Helper()
+	o := options{level: zapcore.DebugLevel}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	core, observed := observer.New(o.level)
+	if o.mirror {
+		core = zapcore.NewTee(core, zaptest.NewLogger(t, zaptest.Level(o.level)).Core())
+	}
+	l := zap.New(core,
+		zap.AddCaller(),
+		// skip the wrapper functions of the log package.
+		zap.AddCallerSkip(1),
+		zap.WithFatalHook(zapcore.WriteThenGoexit),
+	)
+	t.Cleanup(log.ReplaceLogger(l))
+	return &Logs{t: t, observed: observed}
+}
+
+// All returns every captured entry.
+func (l *Logs) All() []observer.LoggedEntry {
+	return l.observed.All()
+}
+
+// Filter returns the captured entries at level whose message contains msg
+// and whose fields include fields.
+func (l *Logs) Filter(level zapcore.Level, msg string, fields ...zap.Field) []observer.LoggedEntry {
+	want := fieldMap(fields)
+	var found []observer.LoggedEntry
+	for _, e := range l.observed.All() {
+		if e.Level != level || !strings.Contains(e.Message, msg) {
+			continue
+		}
+		if hasFields(e.ContextMap(), want) {
+			found = append(found, e)
+		}
+	}
+	return found
+}
+
+// Contains reports whether an entry at level containing msg and fields was logged.
+func (l *Logs) Contains(level zapcore.Level, msg string, fields ...zap.Field) bool {
+	return len(l.Filter(level, msg, fields...)) > 0
+}
+
+// AssertContains fails the test if no entry at level containing msg and fields was logged.
+func (l *Logs) AssertContains(level zapcore.Level, msg string, fields ...zap.Field) {
+	l.t.Helper()
+	if !l.Contains(level, msg, fields...) {
+		l.t.Errorf("no %s entry containing %q with fields %v, logged:\n%s", level.CapitalString(), msg, fieldMap(fields), l)
+	}
+}
+
+// AssertNoErrors fails the test if any entry at ERROR or above was logged.
+func (l *Logs) AssertNoErrors() {
+	l.t.Helper()
+	errs := l.observed.Filter(func(e observer.LoggedEntry) bool {
+		return e.Level >= zapcore.ErrorLevel
+	})
+	if errs.Len() > 0 {
+		l.t.Errorf("%d entries at ERROR or above, logged:\n%s", errs.Len(), l)
+	}
+}
+
+// Reset drops the entries captured so far.
+func (l *Logs) Reset() {
+	l.observed.TakeAll()
+}
+
+// String lists the captured entries, one per line.
+func (l *Logs) String() string {
+	var b strings.Builder
+	for _, e := range l.observed.All() {
+		b.WriteString(e.Level.CapitalString())
+		b.WriteByte('\t')
+		b.WriteString(e.Message)
+		if ctx := e.ContextMap(); len(ctx) > 0 {
+			b.WriteByte('\t')
+			b.WriteString(fmt.Sprint(ctx))
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func fieldMap(fields []zap.Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return enc.Fields
+}
+
+func hasFields(got, want map[string]interface{}) bool {
+	for k, v := range want {
+		if g, ok := got[k]; !ok || !reflect.DeepEqual(g, v) {
+			return false
+		}
+	}
+	return true
+}
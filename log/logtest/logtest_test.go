@@ -0,0 +1,60 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package logtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cauwulixuan/go-kit/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogs(t *testing.T) {
+	logs := New(t, WithMirror())
+	log.Info("user created", zap.String("name", "alice"), zap.Int("id", 1))
+	log.SWarnf("quota at %d%%", 90)
+
+	tests := []struct {
+		name   string
+		level  zapcore.Level
+		msg    string
+		fields []zap.Field
+		want   bool
+	}{
+		{"Message", zap.InfoLevel, "user created", nil, true},
+		{"PartialMessage", zap.WarnLevel, "quota", nil, true},
+		{"Fields", zap.InfoLevel, "user", []zap.Field{zap.Int("id", 1)}, true},
+		{"WrongField", zap.InfoLevel, "user", []zap.Field{zap.Int("id", 2)}, false},
+		{"WrongLevel", zap.ErrorLevel, "user created", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logs.Contains(tt.level, tt.msg, tt.fields...); got != tt.want {
+				t.Errorf("Contains() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	logs.AssertNoErrors()
+
+	if got := logs.All()[0].Caller.TrimmedPath(); !strings.HasPrefix(got, "logtest/logtest_test.go") {
+		t.Errorf("caller = %v, want logtest/logtest_test.go", got)
+	}
+}
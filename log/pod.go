@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+package log
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// serviceAccountNamespace is mounted into every Pod with a service account.
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// PodInfo describes the Pod the process runs in, as exposed by the downward API:
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom: {fieldRef: {fieldPath: metadata.name}}
+//	- name: POD_NAMESPACE
+//	  valueFrom: {fieldRef: {fieldPath: metadata.namespace}}
+//	- name: NODE_NAME
+//	  valueFrom: {fieldRef: {fieldPath: spec.nodeName}}
+//	- name: POD_IP
+//	  valueFrom: {fieldRef: {fieldPath: status.podIP}}
+//	- name: CONTAINER_NAME
+//	  value: app
+//
+// Labels are read from the labels file of a downward API volume mounted at log.k8s.podinfo_dir.
+type PodInfo struct {
+	Name      string
+	Namespace string
+	Node      string
+	IP        string
+	Container string
+	Labels    map[string]string
+}
+
+// CurrentPod returns the PodInfo of the process, false if it is not running in a cluster.
+func CurrentPod() (PodInfo, bool) {
+	return readPodInfo(os.Getenv, viper.GetString("log.k8s.podinfo_dir"), serviceAccountNamespace)
+}
+
+func readPodInfo(getenv func(string) string, podinfoDir, namespaceFile string) (PodInfo, bool) {
+	if getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return PodInfo{}, false
+	}
+	info := PodInfo{
+		Name:      getenv("POD_NAME"),
+		Namespace: getenv("POD_NAMESPACE"),
+		Node:      getenv("NODE_NAME"),
+		IP:        getenv("POD_IP"),
+		Container: getenv("CONTAINER_NAME"),
+	}
+	// the hostname of a Pod is its name.
+	if info.Name == "" {
+		info.Name = getenv("HOSTNAME")
+	}
+	if info.Namespace == "" {
+		if b, err := os.ReadFile(namespaceFile); err == nil {
+			info.Namespace = strings.TrimSpace(string(b))
+		}
+	}
+	if podinfoDir != "" {
+		info.Labels = readDownwardAPIMap(filepath.Join(podinfoDir, "labels"))
+	}
+	return info, true
+}
+
+// readDownwardAPIMap reads the key="value" lines of a downward API labels or annotations file.
+func readDownwardAPIMap(path string) map[string]string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	m := make(map[string]string)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		m[key] = value
+	}
+	return m
+}
+
+// PodField returns a field named with the log.k8s.prefix, for Pod metadata added by AddFields.
+func PodField(key string, value interface{}) zap.Field {
+	return zap.Any(viper.GetString("log.k8s.prefix")+key, value)
+}
+
+// podFields returns the fields of CurrentPod if log.k8s.enable is set, none outside a cluster.
+func podFields() []zap.Field {
+	if !viper.GetBool("log.k8s.enable") {
+		return nil
+	}
+	info, ok := CurrentPod()
+	if !ok {
+		return nil
+	}
+	var fields []zap.Field
+	for _, f := range []struct{ key, value string }{
+		{"pod", info.Name},
+		{"namespace", info.Namespace},
+		{"node", info.Node},
+		{"pod_ip", info.IP},
+		{"container", info.Container},
+	} {
+		if f.value != "" {
+			fields = append(fields, PodField(f.key, f.value))
+		}
+	}
+	if len(info.Labels) > 0 {
+		fields = append(fields, PodField("labels", info.Labels))
+	}
+	return fields
+}
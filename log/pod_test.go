@@ -0,0 +1,70 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadPodInfo(t *testing.T) {
+	dir := t.TempDir()
+	namespaceFile := filepath.Join(dir, "namespace")
+	if err := os.WriteFile(namespaceFile, []byte("jobs\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "labels"), []byte("app=\"trainer\"\npod-template-hash=\"5d8f\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		env    map[string]string
+		want   PodInfo
+		wantOK bool
+	}{
+		{"OutsideCluster", map[string]string{"POD_NAME": "trainer-0"}, PodInfo{}, false},
+		{"DownwardAPI", map[string]string{
+			"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+			"POD_NAME":                "trainer-0",
+			"POD_NAMESPACE":           "default",
+			"NODE_NAME":               "node-1",
+			"POD_IP":                  "10.1.0.5",
+			"CONTAINER_NAME":          "app",
+		}, PodInfo{Name: "trainer-0", Namespace: "default", Node: "node-1", IP: "10.1.0.5", Container: "app",
+			Labels: map[string]string{"app": "trainer", "pod-template-hash": "5d8f"}}, true},
+		{"Fallbacks", map[string]string{
+			"KUBERNETES_SERVICE_HOST": "10.0.0.1",
+			"HOSTNAME":                "trainer-1",
+		}, PodInfo{Name: "trainer-1", Namespace: "jobs",
+			Labels: map[string]string{"app": "trainer", "pod-template-hash": "5d8f"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := readPodInfo(func(key string) string { return tt.env[key] }, dir, namespaceFile)
+			if ok != tt.wantOK {
+				t.Fatalf("readPodInfo() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readPodInfo() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
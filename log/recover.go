@@ -0,0 +1,122 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+package log
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/cauwulixuan/go-kit/errors"
+	"github.com/cauwulixuan/go-kit/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var panicsRecovered = metrics.Factory().NewCounterVec(prometheus.CounterOpts{
+	Namespace: metrics.Namespace,
+	Subsystem: "panics",
+	Name:      "recovered_total",
+	Help:      "Number of panics recovered, by goroutine name.",
+}, []string{"name"})
+
+// Go runs fn in a new goroutine named name, its panic is recovered by Recover.
+func Go(ctx context.Context, name string, fn func(ctx context.Context)) {
+	go func() {
+		defer Recover(name)
+		fn(ctx)
+	}()
+}
+
+// Recover logs the panic of the goroutine named name with its stack, it must be deferred:
+//
+//	defer log.Recover("worker")
+//
+// The panic is raised again after logging if log.recover.repanic is set.
+func Recover(name string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	logPanic(name, r)
+	if viper.GetBool("log.recover.repanic") {
+		panic(r)
+	}
+}
+
+// RecoverHandler recovers the panic of next per request, logs it with the request
+// and responds 500 Internal Server Error, unless next has written the response header already.
+func RecoverHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hw := &headerWriter{ResponseWriter: w}
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// net/http aborts the response silently on ErrAbortHandler.
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+			logPanic("http", rec, zap.String("method", r.Method), zap.String("url", r.URL.String()),
+				zap.Bool("header_written", hw.wroteHeader))
+			if !hw.wroteHeader {
+				errors.WriteHTTP(w, errors.New(errors.Internal, "internal server error"))
+			}
+		}()
+		next.ServeHTTP(hw, r)
+	})
+}
+
+// headerWriter records whether the response header was written to a http.ResponseWriter.
+type headerWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *headerWriter) WriteHeader(status int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *headerWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (w *headerWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// logPanic logs r at ERROR with the stack of the panicking goroutine and flushes the logger,
+// since the process may crash right after.
+func logPanic(name string, r interface{}, fields ...zap.Field) {
+	panicsRecovered.WithLabelValues(name).Inc()
+	fields = append(fields, zap.String("goroutine", name))
+	if err, ok := r.(error); ok {
+		fields = append(fields, zap.NamedError("panic", err))
+	} else {
+		fields = append(fields, zap.String("panic", fmt.Sprint(r)))
+	}
+	// deferred functions run on top of the panicking frames, so the stack shows where it panicked.
+	l := logger.WithOptions(zap.AddStacktrace(zap.ErrorLevel))
+	l.Error("Recovered from panic", fields...)
+	_ = l.Sync()
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+package log
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRecover(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer ReplaceLogger(zap.New(core, zap.AddCallerSkip(1)))()
+
+	before := testutil.ToFloat64(panicsRecovered.WithLabelValues("worker"))
+	done := make(chan struct{})
+	Go(context.Background(), "worker", func(ctx context.Context) {
+		defer close(done)
+		panic("boom")
+	})
+	<-done
+
+	rec := httptest.NewRecorder()
+	RecoverHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("handler boom")
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %v, want %v", rec.Code, http.StatusInternalServerError)
+	}
+
+	// Go's entry is logged after done is closed, by the deferred Recover.
+	entries := logs.FilterMessage("Recovered from panic")
+	for i := 0; i < 100 && entries.Len() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+		entries = logs.FilterMessage("Recovered from panic")
+	}
+	if entries.Len() != 2 {
+		t.Fatalf("logged %d panics, want 2", entries.Len())
+	}
+	for _, e := range entries.All() {
+		name := e.ContextMap()["goroutine"]
+		if name != "worker" && name != "http" {
+			t.Errorf("goroutine = %v, want worker or http", name)
+		}
+		if !strings.Contains(e.Stack, "panic") {
+			t.Errorf("stack = %v, want the panicking frames", e.Stack)
+		}
+	}
+	if got := testutil.ToFloat64(panicsRecovered.WithLabelValues("worker")) - before; got != 1 {
+		t.Errorf("recovered_total{name=worker} increased by %v, want 1", got)
+	}
+}
+
+func TestRecoverHandlerAfterHeader(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	defer ReplaceLogger(zap.New(core, zap.AddCallerSkip(1)))()
+
+	rec := httptest.NewRecorder()
+	RecoverHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte("partial"))
+		panic("handler boom")
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" {
+		t.Errorf("response = %v %q, want the 200 partial written before the panic", rec.Code, rec.Body.String())
+	}
+	if entries := logs.FilterField(zap.Bool("header_written", true)); entries.Len() != 1 {
+		t.Errorf("logged %d panics after the header, want 1", entries.Len())
+	}
+}
@@ -0,0 +1,463 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	megabyte = 1024 * 1024
+
+	// DefaultFilenamePattern names rotated files like info-2026-10-18.log.
+	DefaultFilenamePattern = "{name}-{time}{ext}"
+	compressSuffix         = ".gz"
+)
+
+// Clock tells the current time, it is replaced in tests.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// RotateConfig describes when a RotateWriter rotates and how long backups are kept.
+type RotateConfig struct {
+	// Filename is the file written to, rotated files are kept in the same directory.
+	Filename string
+	// MaxSize rotates the file once it would exceed MaxSize megabytes, 0 disables it.
+	MaxSize int
+	// Interval rotates the file when a new period starts, 0 disables it.
+	// Periods of 24h or multiples of it start at local midnight.
+	Interval time.Duration
+	// Pattern names rotated files from the {name}, {time} and {ext} of Filename.
+	// A ".N" index is added before {ext} if the name is already taken.
+	Pattern string
+	// TimeLayout formats {time}, it is derived from Interval if empty.
+	TimeLayout string
+	// MaxAge removes rotated files older than MaxAge days, 0 keeps them.
+	MaxAge int
+	// MaxBackups keeps at most MaxBackups rotated files, 0 keeps them all.
+	MaxBackups int
+	// Compress gzips rotated files in the background.
+	Compress bool
+	// Clock defaults to the system clock.
+	Clock Clock
+}
+
+// RotateWriter is an io.WriteCloser rotating its file by size and time.
+type RotateWriter struct {
+	cfg       RotateConfig
+	retention *Retention
+	matcher   *regexp.Regexp
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	period time.Time
+
+	// wg tracks background compression and retention.
+	wg sync.WaitGroup
+}
+
+// NewRotateWriter returns a writer which opens cfg.Filename on the first write.
+// Retention across several writers is enforced by r, a new Retention is used if nil.
+func NewRotateWriter(cfg RotateConfig, r *Retention) *RotateWriter {
+	if cfg.Pattern == "" {
+		cfg.Pattern = DefaultFilenamePattern
+	}
+	if cfg.TimeLayout == "" {
+		cfg.TimeLayout = timeLayoutOf(cfg.Interval)
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = systemClock{}
+	}
+	if r == nil {
+		r = NewRetention(0, cfg.Clock)
+	}
+	w := &RotateWriter{cfg: cfg, retention: r, matcher: backupMatcher(cfg)}
+	r.add(w)
+	return w
+}
+
+func timeLayoutOf(interval time.Duration) string {
+	switch {
+	case interval > 0 && interval%(24*time.Hour) == 0:
+		return "2006-01-02"
+	case interval > 0 && interval%time.Hour == 0:
+		return "2006-01-02T15"
+	default:
+		return "2006-01-02T15-04-05"
+	}
+}
+
+// backupMatcher matches rotated files of cfg.Filename, submatches are
+// the {time}, the ".N" index and the compress suffix.
+func backupMatcher(cfg RotateConfig) *regexp.Regexp {
+	name, ext := splitExt(filepath.Base(cfg.Filename))
+	expr := regexp.QuoteMeta(cfg.Pattern)
+	expr = strings.Replace(expr, regexp.QuoteMeta("{name}"), regexp.QuoteMeta(name), 1)
+	expr = strings.Replace(expr, regexp.QuoteMeta("{time}"), "(.+?)", 1)
+	expr = strings.Replace(expr, regexp.QuoteMeta("{ext}"), `(?:\.(\d+))?`+regexp.QuoteMeta(ext), 1)
+	return regexp.MustCompile("^" + expr + "(" + regexp.QuoteMeta(compressSuffix) + ")?$")
+}
+
+func splitExt(base string) (string, string) {
+	ext := filepath.Ext(base)
+	return strings.TrimSuffix(base, ext), ext
+}
+
+// Write writes p to the current file, rotating it first if needed.
+func (w *RotateWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := w.cfg.Clock.Now()
+	if w.file == nil {
+		if err := w.open(now); err != nil {
+			return 0, err
+		}
+	}
+	if w.shouldRotate(now, int64(len(p))) {
+		if err := w.rotate(now); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Sync commits the current file to disk.
+func (w *RotateWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Sync()
+}
+
+// Rotate closes the current file, renames it after its period and opens a new one.
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.cfg.Clock.Now()
+	if w.file == nil {
+		if err := w.open(now); err != nil {
+			return err
+		}
+	}
+	return w.rotate(now)
+}
+
+// Close closes the current file and waits for background compression and retention.
+// The file is opened again on the next write.
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	var err error
+	if w.file != nil {
+		err = w.file.Close()
+		w.file = nil
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+	return err
+}
+
+func (w *RotateWriter) shouldRotate(now time.Time, n int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.cfg.MaxSize > 0 && w.size+n > int64(w.cfg.MaxSize)*megabyte {
+		return true
+	}
+	return w.cfg.Interval > 0 && !w.periodOf(now).Equal(w.period)
+}
+
+// periodOf returns the start of the rotation period containing t.
+func (w *RotateWriter) periodOf(t time.Time) time.Time {
+	if w.cfg.Interval <= 0 {
+		return time.Time{}
+	}
+	if w.cfg.Interval%(24*time.Hour) == 0 {
+		y, m, d := t.Date()
+		day := time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+		days := int(w.cfg.Interval / (24 * time.Hour))
+		return day.AddDate(0, 0, -(day.YearDay()-1)%days)
+	}
+	return t.Truncate(w.cfg.Interval)
+}
+
+// open appends to an existing file, keeping the period of its last modification.
+// w.mu must be held.
+func (w *RotateWriter) open(now time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(w.cfg.Filename), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(w.cfg.Filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	w.file, w.size, w.period = f, info.Size(), w.periodOf(now)
+	if info.Size() > 0 {
+		w.period = w.periodOf(info.ModTime())
+	}
+	return nil
+}
+
+// rotate must be called with w.mu held and w.file open.
+func (w *RotateWriter) rotate(now time.Time) error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	stamp := w.period
+	if w.cfg.Interval <= 0 {
+		stamp = now
+	}
+	name, err := w.backupName(stamp)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(w.cfg.Filename, name); err != nil {
+		return err
+	}
+	if err := w.open(now); err != nil {
+		return err
+	}
+	w.period = w.periodOf(now)
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		if w.cfg.Compress {
+			if err := compressFile(name); err != nil {
+				fmt.Fprintf(os.Stderr, "Compressing log file %s failed, error: %v\n", name, err)
+			}
+		}
+		w.retention.Enforce()
+	}()
+	return nil
+}
+
+// backupName returns the first free name for a file rotated at t.
+func (w *RotateWriter) backupName(t time.Time) (string, error) {
+	dir := filepath.Dir(w.cfg.Filename)
+	name, ext := splitExt(filepath.Base(w.cfg.Filename))
+	base := strings.Replace(w.cfg.Pattern, "{name}", name, 1)
+	base = strings.Replace(base, "{time}", t.Format(w.cfg.TimeLayout), 1)
+	for i := 0; i < 10000; i++ {
+		e := ext
+		if i > 0 {
+			e = "." + strconv.Itoa(i) + ext
+		}
+		candidate := filepath.Join(dir, strings.Replace(base, "{ext}", e, 1))
+		if !exists(candidate) && !exists(candidate+compressSuffix) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free backup name for %s", w.cfg.Filename)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+type backupFile struct {
+	path  string
+	time  time.Time
+	index int
+	size  int64
+}
+
+// backups lists rotated files, newest first.
+func (w *RotateWriter) backups() ([]backupFile, error) {
+	dir := filepath.Dir(w.cfg.Filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []backupFile
+	for _, e := range entries {
+		m := w.matcher.FindStringSubmatch(e.Name())
+		if m == nil || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		t, err := time.ParseInLocation(w.cfg.TimeLayout, m[1], time.Local)
+		if err != nil {
+			continue
+		}
+		index, _ := strconv.Atoi(m[2])
+		files = append(files, backupFile{path: filepath.Join(dir, e.Name()), time: t, index: index, size: info.Size()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if !files[i].time.Equal(files[j].time) {
+			return files[i].time.After(files[j].time)
+		}
+		return files[i].index > files[j].index
+	})
+	return files, nil
+}
+
+// activeSize returns the size of the file currently written to.
+func (w *RotateWriter) activeSize() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file != nil {
+		return w.size
+	}
+	if info, err := os.Stat(w.cfg.Filename); err == nil {
+		return info.Size()
+	}
+	return 0
+}
+
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(name+compressSuffix, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(name + compressSuffix)
+		return err
+	}
+	_ = os.Chtimes(name+compressSuffix, info.ModTime(), info.ModTime())
+	return os.Remove(name)
+}
+
+// Retention removes rotated files by max_age and max_backups of each writer,
+// and the oldest rotated files of all writers once their total size exceeds MaxTotalSize.
+type Retention struct {
+	// MaxTotalSize in bytes counts current and rotated files, 0 disables it.
+	MaxTotalSize int64
+
+	clock   Clock
+	mu      sync.Mutex
+	writers []*RotateWriter
+}
+
+// NewRetention returns a Retention capping the total size at maxTotalSize bytes.
+func NewRetention(maxTotalSize int64, clock Clock) *Retention {
+	if clock == nil {
+		clock = systemClock{}
+	}
+	return &Retention{MaxTotalSize: maxTotalSize, clock: clock}
+}
+
+func (r *Retention) add(w *RotateWriter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writers = append(r.writers, w)
+}
+
+// Enforce removes the rotated files exceeding the limits.
+func (r *Retention) Enforce() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock.Now()
+	var (
+		kept  []backupFile
+		total int64
+	)
+	seen := make(map[string]bool)
+	for _, w := range r.writers {
+		total += w.activeSize()
+		files, err := w.backups()
+		if err != nil {
+			continue
+		}
+		n := 0
+		for _, f := range files {
+			if seen[f.path] {
+				continue
+			}
+			seen[f.path] = true
+			expired := w.cfg.MaxAge > 0 && f.time.Before(now.AddDate(0, 0, -w.cfg.MaxAge))
+			if expired || (w.cfg.MaxBackups > 0 && n >= w.cfg.MaxBackups) {
+				_ = os.Remove(f.path)
+				continue
+			}
+			n++
+			total += f.size
+			kept = append(kept, f)
+		}
+	}
+	if r.MaxTotalSize <= 0 || total <= r.MaxTotalSize {
+		return
+	}
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		if !kept[i].time.Equal(kept[j].time) {
+			return kept[i].time.Before(kept[j].time)
+		}
+		return kept[i].index < kept[j].index
+	})
+	for _, f := range kept {
+		if total <= r.MaxTotalSize {
+			return
+		}
+		if err := os.Remove(f.path); err == nil {
+			total -= f.size
+		}
+	}
+}
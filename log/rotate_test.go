@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func listDir(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRotateWriter(t *testing.T) {
+	start := time.Date(2026, 10, 18, 23, 0, 0, 0, time.Local)
+	tests := []struct {
+		name   string
+		cfg    RotateConfig
+		writes []time.Duration
+		want   []string
+	}{
+		{
+			"Daily",
+			RotateConfig{Interval: 24 * time.Hour},
+			[]time.Duration{0, 30 * time.Minute, time.Hour, 24 * time.Hour},
+			[]string{"info-2026-10-18.log", "info-2026-10-19.log", "info.log"},
+		},
+		{
+			"Hourly",
+			RotateConfig{Interval: time.Hour},
+			[]time.Duration{0, time.Hour, time.Hour},
+			[]string{"info-2026-10-18T23.log", "info-2026-10-19T00.log", "info.log"},
+		},
+		{
+			"DailyAndSize",
+			RotateConfig{Interval: 24 * time.Hour, MaxSize: 1},
+			[]time.Duration{0, 0, 0},
+			[]string{"info-2026-10-18.1.log", "info-2026-10-18.log", "info.log"},
+		},
+		{
+			"Pattern",
+			RotateConfig{Interval: 24 * time.Hour, Pattern: "{name}.{time}{ext}", TimeLayout: "20060102"},
+			[]time.Duration{0, time.Hour},
+			[]string{"info.20261018.log", "info.log"},
+		},
+		{
+			"Compress",
+			RotateConfig{Interval: 24 * time.Hour, Compress: true},
+			[]time.Duration{0, time.Hour},
+			[]string{"info-2026-10-18.log.gz", "info.log"},
+		},
+		{
+			"MaxBackups",
+			RotateConfig{Interval: time.Hour, MaxBackups: 1},
+			[]time.Duration{0, time.Hour, time.Hour, time.Hour},
+			[]string{"info-2026-10-19T01.log", "info.log"},
+		},
+		{
+			"MaxAge",
+			RotateConfig{Interval: 24 * time.Hour, MaxAge: 1},
+			[]time.Duration{0, time.Hour, 24 * time.Hour, 24 * time.Hour},
+			[]string{"info-2026-10-20.log", "info.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			clock := &fakeClock{now: start}
+			tt.cfg.Filename = filepath.Join(dir, "info.log")
+			tt.cfg.Clock = clock
+			w := NewRotateWriter(tt.cfg, NewRetention(0, clock))
+
+			line := []byte(strings.Repeat("x", megabyte/2+1))
+			for _, d := range tt.writes {
+				clock.Add(d)
+				if _, err := w.Write(line); err != nil {
+					t.Fatalf("Write() error = %v", err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if got := listDir(t, dir); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetentionMaxTotalSize(t *testing.T) {
+	dir := t.TempDir()
+	clock := &fakeClock{now: time.Date(2026, 10, 18, 10, 0, 0, 0, time.Local)}
+	r := NewRetention(3*1024, clock)
+	info := NewRotateWriter(RotateConfig{Filename: filepath.Join(dir, "info.log"), Interval: time.Hour, Clock: clock}, r)
+	warn := NewRotateWriter(RotateConfig{Filename: filepath.Join(dir, "warn.log"), Interval: time.Hour, Clock: clock}, r)
+
+	line := []byte(strings.Repeat("x", 1024))
+	_, _ = warn.Write(line)
+	for i := 0; i < 3; i++ {
+		_, _ = info.Write(line)
+		clock.Add(time.Hour)
+	}
+	_ = info.Close()
+	_ = warn.Close()
+	r.Enforce()
+
+	// the current files and the newest rotated file fit in 3KB.
+	want := []string{"info-2026-10-18T11.log", "info.log", "warn.log"}
+	if got := listDir(t, dir); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+}
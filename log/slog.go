@@ -0,0 +1,212 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var slogger *slog.Logger
+
+// SlogHandler is a slog.Handler writing through a zap core.
+// Groups are encoded as nested objects, the caller is taken from the record.
+type SlogHandler struct {
+	core zapcore.Core
+	// groups are opened by WithGroup but hold no attrs yet, they are dropped if none follow.
+	groups     []string
+	stacktrace zapcore.LevelEnabler
+}
+
+var _ slog.Handler = &SlogHandler{}
+
+// NewSlogHandler returns a handler writing to core, records at stacktrace levels carry a stack trace.
+// stacktrace may be nil.
+func NewSlogHandler(core zapcore.Core, stacktrace zapcore.LevelEnabler) *SlogHandler {
+	return &SlogHandler{core: core, stacktrace: stacktrace}
+}
+
+// Slog returns a slog.Logger writing to the same cores as the kit's logger.
+func Slog() *slog.Logger {
+	return slogger
+}
+
+func setSlogger(l *zap.Logger, stacktrace zapcore.LevelEnabler) {
+	slogger = slog.New(NewSlogHandler(l.Core(), stacktrace))
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.core.Enabled(zapLevelOfSlog(level))
+}
+
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	ent := zapcore.Entry{
+		Level:   zapLevelOfSlog(r.Level),
+		Time:    r.Time,
+		Message: r.Message,
+	}
+	if r.PC != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		ent.Caller = zapcore.NewEntryCaller(f.PC, f.File, f.Line, true)
+	}
+	if h.stacktrace != nil && h.stacktrace.Enabled(ent.Level) {
+		ent.Stack = stacktraceFrom(r.PC)
+	}
+	ce := h.core.Check(ent, nil)
+	if ce == nil {
+		return nil
+	}
+
+	fields := make([]zapcore.Field, 0, len(h.groups)+r.NumAttrs())
+	if r.NumAttrs() > 0 {
+		fields = append(fields, namespaces(h.groups)...)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		fields = append(fields, fieldOfAttr(a))
+		return true
+	})
+	ce.Write(fields...)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	fields := namespaces(h.groups)
+	for _, a := range attrs {
+		fields = append(fields, fieldOfAttr(a))
+	}
+	return &SlogHandler{core: h.core.With(fields), stacktrace: h.stacktrace}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	return &SlogHandler{
+		core:       h.core,
+		groups:     append(h.groups[:len(h.groups):len(h.groups)], name),
+		stacktrace: h.stacktrace,
+	}
+}
+
+func namespaces(groups []string) []zapcore.Field {
+	fields := make([]zapcore.Field, 0, len(groups))
+	for _, g := range groups {
+		fields = append(fields, zap.Namespace(g))
+	}
+	return fields
+}
+
+// zapLevelOfSlog maps a slog level to the zap level at or below it.
+func zapLevelOfSlog(level slog.Level) zapcore.Level {
+	switch {
+	case level >= slog.LevelError:
+		return zapcore.ErrorLevel
+	case level >= slog.LevelWarn:
+		return zapcore.WarnLevel
+	case level >= slog.LevelInfo:
+		return zapcore.InfoLevel
+	default:
+		return zapcore.DebugLevel
+	}
+}
+
+// fieldOfAttr converts a to a zap field, empty attrs and groups are skipped
+// and errors become error fields so that their details are logged.
+func fieldOfAttr(a slog.Attr) zapcore.Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return zap.Skip()
+	}
+	switch a.Value.Kind() {
+	case slog.KindBool:
+		return zap.Bool(a.Key, a.Value.Bool())
+	case slog.KindDuration:
+		return zap.Duration(a.Key, a.Value.Duration())
+	case slog.KindFloat64:
+		return zap.Float64(a.Key, a.Value.Float64())
+	case slog.KindInt64:
+		return zap.Int64(a.Key, a.Value.Int64())
+	case slog.KindString:
+		return zap.String(a.Key, a.Value.String())
+	case slog.KindTime:
+		return zap.Time(a.Key, a.Value.Time())
+	case slog.KindUint64:
+		return zap.Uint64(a.Key, a.Value.Uint64())
+	case slog.KindGroup:
+		group := attrGroup(a.Value.Group())
+		if len(group) == 0 {
+			return zap.Skip()
+		}
+		if a.Key == "" {
+			return zap.Inline(group)
+		}
+		return zap.Object(a.Key, group)
+	}
+	if err, ok := a.Value.Any().(error); ok {
+		return zap.NamedError(a.Key, err)
+	}
+	return zap.Any(a.Key, a.Value.Any())
+}
+
+// attrGroup encodes the attrs of a group as an object.
+type attrGroup []slog.Attr
+
+func (g attrGroup) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for _, a := range g {
+		fieldOfAttr(a).AddTo(enc)
+	}
+	return nil
+}
+
+// stacktraceFrom formats the stack starting at the frame of pc, the way zap does.
+func stacktraceFrom(pc uintptr) string {
+	pcs := make([]uintptr, 64)
+	pcs = pcs[:runtime.Callers(2, pcs)]
+	for i := range pcs {
+		if pcs[i] == pc {
+			pcs = pcs[i:]
+			break
+		}
+	}
+
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		b.WriteString(f.Function)
+		b.WriteString("\n\t")
+		b.WriteString(f.File)
+		b.WriteByte(':')
+		b.WriteString(strconv.Itoa(f.Line))
+		if !more {
+			break
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
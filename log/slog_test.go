@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package log
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSlogHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		log  func(l *slog.Logger)
+		want string
+	}{
+		{"Caller", func(l *slog.Logger) { l.Info("hello") }, `"caller":"log/slog_test.go:`},
+		{"Fields", func(l *slog.Logger) { l.Info("hello", "count", 1, slog.Bool("ok", true)) },
+			`"msg":"hello","count":1,"ok":true}`},
+		{"Level", func(l *slog.Logger) { l.Warn("careful") }, `"level":"WARN"`},
+		{"Debug", func(l *slog.Logger) { l.Debug("hidden") }, ``},
+		{"Group", func(l *slog.Logger) { l.WithGroup("req").Info("hello", "id", 7) }, `"req":{"id":7}}`},
+		{"EmptyGroup", func(l *slog.Logger) { l.WithGroup("req").Info("hello") }, `"msg":"hello"}`},
+		{"WithAttrs", func(l *slog.Logger) { l.With("svc", "a").WithGroup("req").With("id", 7).Info("hello", "n", 1) },
+			`"svc":"a","req":{"id":7,"n":1}}`},
+		{"GroupAttr", func(l *slog.Logger) { l.Info("hello", slog.Group("user", "name", "x"), slog.Group("empty")) },
+			`"user":{"name":"x"}}`},
+		{"Error", func(l *slog.Logger) { l.Error("failed", "error", errors.New("boom")) }, `"error":"boom"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			enc := zapcore.NewJSONEncoder(NewCustomEncoderConfig())
+			l := slog.New(NewSlogHandler(newIOCore(enc, zapcore.AddSync(&buf), zapcore.InfoLevel), nil))
+			tt.log(l)
+			got := buf.String()
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("output = %v, want none", got)
+				}
+				return
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("output = %v, want it to contain %v", got, tt.want)
+			}
+		})
+	}
+}
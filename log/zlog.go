@@ -19,17 +19,29 @@ limitations under the License.
 package log
 
 import (
+	"fmt"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
 	"io"
 	"os"
+	"sync"
+	"time"
 )
 
 var (
 	logger  *zap.Logger
 	Slogger *zap.SugaredLogger
+
+	collector *Collector
+	// asyncWritersMu guards asyncWriters, Init appends to it while AsyncDropped may be read from another goroutine.
+	asyncWritersMu sync.Mutex
+	asyncWriters   []*AsyncWriter
+	rotateWriters  []*RotateWriter
+	retention      *Retention
+	// stacktraceLevel is the stack trace level of the global logger.
+	stacktraceLevel zapcore.LevelEnabler
 )
 
 func getLogLevel(level string) zapcore.Level {
@@ -64,25 +76,14 @@ func Init(multi bool) {
 func InitWithSingleLevelOutput() {
 	level := getLogLevel(viper.GetString("log.level"))
 	atom := zap.NewAtomicLevelAt(level)
-	core := zapcore.NewCore(
-		zapcore.NewConsoleEncoder(NewCustomEncoderConfig()),
-		zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout), zapcore.AddSync(getAllLogWriter())),
-		atom,
+	resetWriters()
+	// the file gets its own core, the colors of log.level_format only belong on the console.
+	core := zapcore.NewTee(
+		newCore(newEncoder("console", true), zapcore.AddSync(os.Stdout), atom),
+		newCore(newEncoder("console", false), zapcore.AddSync(getAllLogWriter()), atom),
 	)
 
-	// 1. AddCaller with file name and line number.
-	// 2. AddStacktrace record a stack trace for all messages at or above WARN level.
-	// 3. Add serviceName field.
-	field := zap.Fields(zap.String("serviceName", viper.GetString("svc_name")))
-
-	// zap.AddCallerSkip(1) skip wrapper function.
-	logger = zap.New(core, zap.AddCaller(), zap.AddStacktrace(zap.LevelEnablerFunc(warnLevel)), zap.AddCallerSkip(1), field)
-	defer logger.Sync()
-
-	zap.ReplaceGlobals(logger)
-	Slogger = logger.Sugar()
-	defer Slogger.Sync()
-	Slogger.Info("Setting logger successfully.")
+	setLogger(core, zap.LevelEnablerFunc(warnLevel))
 }
 
 // return log with level above INFO
@@ -95,6 +96,7 @@ func infoLevel(l zapcore.Level) bool {
 }
 
 func InitWithMultiLevelOutPut() {
+	resetWriters()
 	atom := zap.NewAtomicLevelAt(getLogLevel(viper.GetString("log.level")))
 	// define LevelEnablerFunc
 	infoLvl := zap.LevelEnablerFunc(infoLevel)
@@ -106,47 +108,234 @@ func InitWithMultiLevelOutPut() {
 
 	// with multiple output
 	core := zapcore.NewTee(
-		zapcore.NewCore(zapcore.NewJSONEncoder(NewCustomEncoderConfig()), zapcore.AddSync(infoWriter), infoLvl),
-		zapcore.NewCore(zapcore.NewJSONEncoder(NewCustomEncoderConfig()), zapcore.AddSync(warnWriter), warnLvl),
-		zapcore.NewCore(zapcore.NewConsoleEncoder(NewCustomEncoderConfig()), zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout)), atom),
+		newCore(newEncoder("json", false), zapcore.AddSync(infoWriter), infoLvl),
+		newCore(newEncoder("json", false), zapcore.AddSync(warnWriter), warnLvl),
+		newCore(newEncoder("console", true), zapcore.NewMultiWriteSyncer(zapcore.AddSync(os.Stdout)), atom),
 	)
+	setLogger(core, warnLvl)
+}
+
+// newCore builds a core writing to ws, through an AsyncWriter if log.async.enable is set.
+func newCore(enc zapcore.Encoder, ws zapcore.WriteSyncer, enab zapcore.LevelEnabler) zapcore.Core {
+	if !viper.GetBool("log.async.enable") {
+		return newIOCore(enc, ws, enab)
+	}
+	w := NewAsyncWriter(ws, viper.GetInt("log.async.buffer_size"), viper.GetString("log.async.overflow"))
+	asyncWritersMu.Lock()
+	asyncWriters = append(asyncWriters, w)
+	asyncWritersMu.Unlock()
+	return newAsyncCore(enc, w, enab)
+}
+
+// Close flushes the logger, drains the async buffers and stops the log collector.
+// It should be deferred in main.
+func Close() {
+	if logger != nil {
+		_ = logger.Sync()
+	}
+	resetWriters()
+	if collector != nil {
+		_ = collector.Close()
+		collector = nil
+	}
+}
+
+// setLogger builds the global logger on top of core and the optional extra cores.
+func setLogger(core zapcore.Core, stacktraceLvl zapcore.LevelEnabler) {
+	if cc := getCollectorCore(); cc != nil {
+		core = zapcore.NewTee(core, cc)
+	}
+	configureAlerts()
+	core = zapcore.NewTee(core, &alertCore{alerts: alerts})
+
 	// 1. AddCaller with file name and line number.
 	// 2. AddStacktrace record a stack trace for all messages at or above WARN level.
-	// 3. Add serviceName field.
-	field := zap.Fields(zap.String("serviceName", viper.GetString("svc_name")))
+	// 3. Add serviceName field, and the Pod metadata if log.k8s.enable is set.
+	field := zap.Fields(append([]zap.Field{zap.String("serviceName", viper.GetString("svc_name"))}, podFields()...)...)
 
 	// zap.AddCallerSkip(1) skip wrapper function.
-	logger = zap.New(core, zap.AddCaller(), zap.AddStacktrace(warnLvl), zap.AddCallerSkip(1), field)
+	logger = zap.New(core, zap.AddCaller(), zap.AddStacktrace(stacktraceLvl), zap.AddCallerSkip(1), field)
 	defer logger.Sync()
 
-	zap.ReplaceGlobals(logger)
-	Slogger = logger.Sugar()
+	stacktraceLevel = stacktraceLvl
+	replaceGlobals()
 	defer Slogger.Sync()
 	Slogger.Info("Setting logger successfully.")
+}
 
+// AddFields adds fields to every entry of the global logger, e.g. metadata known only after Init.
+func AddFields(fields ...zap.Field) {
+	if logger == nil {
+		return
+	}
+	logger = logger.With(fields...)
+	replaceGlobals()
 }
 
+// replaceGlobals derives the other loggers and the bridges from logger.
+func replaceGlobals() {
+	zap.ReplaceGlobals(logger)
+	Slogger = logger.Sugar()
+	setSlogger(logger, stacktraceLevel)
+	installBridges()
+}
+
+// ReplaceLogger replaces the global logger and returns a function restoring the previous one.
+// The wrapper functions use l as is, so it should be built with zap.AddCallerSkip(1).
+func ReplaceLogger(l *zap.Logger) func() {
+	prevLogger, prevSlogger, prevSlog := logger, Slogger, slogger
+	restoreGlobals := zap.ReplaceGlobals(l)
+	logger, Slogger = l, l.Sugar()
+	setSlogger(l, nil)
+	return func() {
+		restoreGlobals()
+		logger, Slogger, slogger = prevLogger, prevSlogger, prevSlog
+	}
+}
+
+// getCollectorCore returns a JSON core shipping to the configured log collector,
+// or nil if log.collector.enable is not set.
+func getCollectorCore() zapcore.Core {
+	if !viper.GetBool("log.collector.enable") {
+		return nil
+	}
+	if collector != nil {
+		_ = collector.Close()
+	}
+	c, err := NewCollector(getCollectorConfig())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Setting log collector failed, error: %v\n", err)
+		return nil
+	}
+	collector = c
+	return newIOCore(zapcore.NewJSONEncoder(NewCustomEncoderConfig()), collector, zap.NewAtomicLevelAt(getLogLevel(viper.GetString("log.level"))))
+}
+
+// NewCustomEncoderConfig returns the encoder config set by log.time_format, log.time_zone,
+// log.level_format, log.caller and log.keys. The levels are not colored, see newEncoder.
 func NewCustomEncoderConfig() zapcore.EncoderConfig {
+	callerKey := getKey("caller", "caller")
+	if viper.GetString("log.caller") == "off" {
+		callerKey = zapcore.OmitKey
+	}
 	return zapcore.EncoderConfig{
-		MessageKey:     "msg",
-		LevelKey:       "level",
-		TimeKey:        "time",
-		NameKey:        "logger",
-		CallerKey:      "caller",
+		MessageKey:     getKey("message", "msg"),
+		LevelKey:       getKey("level", "level"),
+		TimeKey:        getKey("time", "time"),
+		NameKey:        getKey("logger", "logger"),
+		CallerKey:      callerKey,
 		FunctionKey:    zapcore.OmitKey,
-		StacktraceKey:  "stacktrace",
+		StacktraceKey:  getKey("stacktrace", "stacktrace"),
 		SkipLineEnding: false,
 		LineEnding:     zapcore.DefaultLineEnding,
-		EncodeLevel:    zapcore.CapitalLevelEncoder,
+		EncodeLevel:    getEncodeLevel(viper.GetString("log.level_format"), false),
 		EncodeTime:     getEncodeTime(),
 		EncodeDuration: zapcore.SecondsDurationEncoder,
-		EncodeCaller:   zapcore.ShortCallerEncoder,
+		EncodeCaller:   getEncodeCaller(viper.GetString("log.caller")),
 		EncodeName:     zapcore.FullNameEncoder,
 	}
 }
 
+// getKey returns the key name set by log.keys.<name>, or def.
+func getKey(name, def string) string {
+	if key := viper.GetString("log.keys." + name); key != "" {
+		return key
+	}
+	return def
+}
+
+// newEncoder returns the encoder set by log.format, or the one of def if it is not set.
+// The levels are colored as set by log.level_format only if color is set, for the console.
+func newEncoder(def string, color bool) zapcore.Encoder {
+	format := viper.GetString("log.format")
+	switch format {
+	case "json", "console", "logfmt":
+	case "":
+		format = def
+	default:
+		fmt.Fprintf(os.Stderr, "Invalid log.format %q, using %s\n", format, def)
+		format = def
+	}
+
+	cfg := NewCustomEncoderConfig()
+	if color {
+		cfg.EncodeLevel = getEncodeLevel(viper.GetString("log.level_format"), true)
+	}
+	switch format {
+	case "json":
+		return zapcore.NewJSONEncoder(cfg)
+	case "logfmt":
+		return NewLogfmtEncoder(cfg)
+	default:
+		return zapcore.NewConsoleEncoder(cfg)
+	}
+}
+
+// getEncodeLevel returns the level encoder of format, the color formats fall back to
+// their plain ones unless color is set.
+func getEncodeLevel(format string, color bool) zapcore.LevelEncoder {
+	switch {
+	case format == "lowercase", format == "lowercase_color" && !color:
+		return zapcore.LowercaseLevelEncoder
+	case format == "capital_color" && color:
+		return zapcore.CapitalColorLevelEncoder
+	case format == "lowercase_color":
+		return zapcore.LowercaseColorLevelEncoder
+	default:
+		return zapcore.CapitalLevelEncoder
+	}
+}
+
+func getEncodeCaller(format string) zapcore.CallerEncoder {
+	if format == "full" {
+		return zapcore.FullCallerEncoder
+	}
+	return zapcore.ShortCallerEncoder
+}
+
+// getEncodeTime returns the time encoder of log.time_format in the zone of log.time_zone.
+// log.time_format is rfc3339, rfc3339nano, iso8601, epoch, epoch_millis, epoch_nanos or a Go time layout.
 func getEncodeTime() zapcore.TimeEncoder {
-	return zapcore.TimeEncoderOfLayout("2006-01-02 15:04:05.0000000")
+	var enc zapcore.TimeEncoder
+	switch format := viper.GetString("log.time_format"); format {
+	case "":
+		enc = zapcore.TimeEncoderOfLayout("2006-01-02 15:04:05.0000000")
+	case "rfc3339":
+		enc = zapcore.RFC3339TimeEncoder
+	case "rfc3339nano":
+		enc = zapcore.RFC3339NanoTimeEncoder
+	case "iso8601":
+		enc = zapcore.ISO8601TimeEncoder
+	case "epoch":
+		enc = zapcore.EpochTimeEncoder
+	case "epoch_millis":
+		enc = zapcore.EpochMillisTimeEncoder
+	case "epoch_nanos":
+		enc = zapcore.EpochNanosTimeEncoder
+	default:
+		enc = zapcore.TimeEncoderOfLayout(format)
+	}
+
+	loc := getTimeZone(viper.GetString("log.time_zone"))
+	if loc == nil {
+		return enc
+	}
+	return func(t time.Time, pae zapcore.PrimitiveArrayEncoder) {
+		enc(t.In(loc), pae)
+	}
+}
+
+// getTimeZone loads an IANA time zone such as UTC or Asia/Shanghai, nil means local time.
+func getTimeZone(name string) *time.Location {
+	if name == "" || name == "Local" {
+		return nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid log.time_zone %q, using local time, error: %v\n", name, err)
+		return nil
+	}
+	return loc
 }
 
 func getWarnLogWriter() io.Writer {
@@ -161,7 +350,27 @@ func getAllLogWriter() io.Writer {
 	return getLogWriter(viper.GetString("log.rotate.all_log_path"))
 }
 
+// getLogWriter returns a RotateWriter if time based rotation or a total size cap is configured,
+// otherwise a lumberjack.Logger rotating by size.
 func getLogWriter(path string) io.Writer {
+	interval := getRotateInterval(viper.GetString("log.rotate.interval"))
+	if interval > 0 || viper.GetInt("log.rotate.max_total_size") > 0 || viper.GetString("log.rotate.filename_pattern") != "" {
+		if retention == nil {
+			retention = NewRetention(int64(viper.GetInt("log.rotate.max_total_size"))*megabyte, nil)
+		}
+		w := NewRotateWriter(RotateConfig{
+			Filename:   path,
+			MaxSize:    viper.GetInt("log.rotate.max_size"),
+			Interval:   interval,
+			Pattern:    viper.GetString("log.rotate.filename_pattern"),
+			TimeLayout: viper.GetString("log.rotate.time_layout"),
+			MaxAge:     viper.GetInt("log.rotate.max_age"),
+			MaxBackups: viper.GetInt("log.rotate.max_backups"),
+			Compress:   viper.GetBool("log.rotate.compress"),
+		}, retention)
+		rotateWriters = append(rotateWriters, w)
+		return w
+	}
 	return &lumberjack.Logger{
 		Filename: path,
 		// unit: megabytes
@@ -174,3 +383,31 @@ func getLogWriter(path string) io.Writer {
 		Compress: viper.GetBool("log.rotate.compress"),
 	}
 }
+
+// getRotateInterval parses "daily", "hourly" or a duration such as "30m", 0 disables time based rotation.
+func getRotateInterval(interval string) time.Duration {
+	switch interval {
+	case "":
+		return 0
+	case "daily":
+		return 24 * time.Hour
+	case "hourly":
+		return time.Hour
+	}
+	d, err := time.ParseDuration(interval)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid log.rotate.interval %q, error: %v\n", interval, err)
+		return 0
+	}
+	return d
+}
+
+// resetWriters releases the writers of the previous logger before building a new one.
+func resetWriters() {
+	closeAsyncWriters()
+	for _, w := range rotateWriters {
+		_ = w.Close()
+	}
+	rotateWriters = nil
+	retention = nil
+}
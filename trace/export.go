@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package trace
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/cauwulixuan/go-kit/log"
+	"github.com/spf13/viper"
+)
+
+// Exporter sends the finished spans to a tracing backend.
+type Exporter interface {
+	Export(span SpanData) error
+}
+
+var (
+	mu       sync.RWMutex
+	exporter Exporter
+	service  string
+	b3       bool
+)
+
+// Init sets the exporter, the service name and the propagation formats as set by trace.
+// The exporter set before is closed if it is an io.Closer, such as the FileExporter of a previous Init.
+func Init() {
+	mu.Lock()
+	service = viper.GetString("svc_name")
+	b3 = viper.GetBool("trace.b3")
+	mu.Unlock()
+
+	var e Exporter
+	switch kind := viper.GetString("trace.exporter"); kind {
+	case "", "none":
+	case "file":
+		fe, err := NewFileExporter(viper.GetString("trace.file"))
+		if err != nil {
+			log.Slogger.Errorf("Opening trace file failed, dropping the spans, error: %v", err)
+			break
+		}
+		e = fe
+	default:
+		log.Slogger.Errorf("Unknown trace exporter %s, dropping the spans", kind)
+	}
+	if err := closeExporter(swapExporter(e)); err != nil {
+		log.Slogger.Errorf("Closing previous trace exporter failed, error: %v", err)
+	}
+}
+
+// Close drops the spans from then on and closes the exporter if it is an io.Closer.
+func Close() error {
+	return closeExporter(swapExporter(nil))
+}
+
+func swapExporter(e Exporter) Exporter {
+	mu.Lock()
+	defer mu.Unlock()
+	prev := exporter
+	exporter = e
+	return prev
+}
+
+func closeExporter(e Exporter) error {
+	if c, ok := e.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// SetExporter replaces the exporter of the finished spans, nil drops them,
+// and returns a function restoring the previous one. The previous one is left open for it.
+func SetExporter(e Exporter) func() {
+	prev := swapExporter(e)
+	return func() {
+		swapExporter(prev)
+	}
+}
+
+// export holds mu for reading, so that an exporter is not closed while exporting.
+func export(span SpanData) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e := exporter
+	if e == nil {
+		return
+	}
+	if err := e.Export(span); err != nil {
+		log.Slogger.Errorf("Exporting span %s of trace %s failed, error: %v", span.Name, span.TraceID, err)
+	}
+}
+
+func serviceName() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return service
+}
+
+// MemoryExporter keeps the finished spans in memory, for tests.
+type MemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewMemoryExporter returns an empty MemoryExporter.
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{}
+}
+
+func (e *MemoryExporter) Export(span SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, span)
+	return nil
+}
+
+// Spans returns the spans exported so far, in the order they ended.
+func (e *MemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset drops the spans exported so far.
+func (e *MemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// FileExporter appends the finished spans to a file as JSON lines.
+type FileExporter struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewFileExporter returns a FileExporter appending to path, which is created with its directory if needed.
+func NewFileExporter(path string) (*FileExporter, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (e *FileExporter) Export(span SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.enc.Encode(span)
+}
+
+// Close closes the file.
+func (e *FileExporter) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.f.Close()
+}
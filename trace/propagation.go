@@ -0,0 +1,144 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package trace
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Headers of W3C Trace Context and of B3 multi and single header propagation.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+	B3TraceIDHeader   = "X-B3-TraceId"
+	B3SpanIDHeader    = "X-B3-SpanId"
+	B3SampledHeader   = "X-B3-Sampled"
+	B3Header          = "b3"
+)
+
+// Inject sets the traceparent and tracestate headers of the span context of ctx in h,
+// and the B3 ones too if trace.b3 is set. h is left as is if ctx has no span context.
+func Inject(ctx context.Context, h http.Header) {
+	sc := SpanContextFrom(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	h.Set(TraceparentHeader, FormatTraceparent(sc))
+	if sc.TraceState != "" {
+		h.Set(TracestateHeader, sc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+
+	mu.RLock()
+	withB3 := b3
+	mu.RUnlock()
+	if withB3 {
+		injectB3(sc, h)
+	}
+}
+
+func injectB3(sc SpanContext, h http.Header) {
+	h.Set(B3TraceIDHeader, sc.TraceID.String())
+	h.Set(B3SpanIDHeader, sc.SpanID.String())
+	if sc.Sampled {
+		h.Set(B3SampledHeader, "1")
+	} else {
+		h.Set(B3SampledHeader, "0")
+	}
+}
+
+// Extract returns a copy of ctx carrying the span context of the headers h, the traceparent header
+// or else the B3 ones. ctx is returned as is if h has no valid one.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceparent(h.Get(TraceparentHeader))
+	if err == nil {
+		sc.TraceState = h.Get(TracestateHeader)
+	} else if sc, err = parseB3(h); err != nil {
+		return ctx
+	}
+	sc.Remote = true
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// FormatTraceparent returns the traceparent header of sc.
+func FormatTraceparent(sc SpanContext) string {
+	flags := 0
+	if sc.Sampled {
+		flags = 1
+	}
+	return fmt.Sprintf("00-%s-%s-%02x", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a traceparent header. Versions after 00 are parsed as 00, as the spec says.
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	if len(s) < 55 || len(s) > 55 && (s[:2] == "00" || s[55] != '-') {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	parts := strings.Split(s[:55], "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	var version, flags [1]byte
+	if !decodeHex(version[:], parts[0]) || !decodeHex(sc.TraceID[:], parts[1]) ||
+		!decodeHex(sc.SpanID[:], parts[2]) || !decodeHex(flags[:], parts[3]) || !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", s)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// parseB3 parses the b3 single header or else the X-B3 ones, 64 bit trace IDs are padded.
+func parseB3(h http.Header) (SpanContext, error) {
+	traceID, spanID, sampled := h.Get(B3TraceIDHeader), h.Get(B3SpanIDHeader), h.Get(B3SampledHeader)
+	if single := h.Get(B3Header); single != "" {
+		parts := strings.Split(single, "-")
+		if len(parts) < 2 {
+			return SpanContext{}, fmt.Errorf("invalid b3 header %q", single)
+		}
+		traceID, spanID, sampled = parts[0], parts[1], ""
+		if len(parts) > 2 {
+			sampled = parts[2]
+		}
+	}
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	var sc SpanContext
+	if !decodeHex(sc.TraceID[:], traceID) || !decodeHex(sc.SpanID[:], spanID) || !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid b3 trace %q span %q", traceID, spanID)
+	}
+	// an absent sampling decision is left to us.
+	sc.Sampled = sampled != "0" && sampled != "false"
+	return sc, nil
+}
+
+// decodeHex decodes the lowercase hex s into dst, which it must fill exactly.
+func decodeHex(dst []byte, s string) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
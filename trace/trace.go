@@ -0,0 +1,214 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+// Package trace creates spans and propagates their context between services
+// in W3C Trace Context, and optionally B3, headers.
+//
+// Finished spans are handed to the exporter set by SetExporter or Init:
+//
+//	ctx, span := trace.Start(ctx, "sync users", trace.KindInternal)
+//	defer span.End()
+//	users, err := http.GetJSON[[]User](ctx, http.ClientFor("account_server"), "/users")
+//	if err != nil {
+//		span.RecordError(err)
+//	}
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+// IsValid reports whether t is not all zeros.
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+// SpanID identifies a span within its trace.
+type SpanID [8]byte
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+// IsValid reports whether s is not all zeros.
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+// SpanContext is the part of a span propagated to other services.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	// TraceState is the vendor specific tracestate header, passed on as is.
+	TraceState string
+	// Remote is set for the span context of a caller.
+	Remote bool
+}
+
+// IsValid reports whether sc has a trace and a span ID.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Kind tells what a span stands for.
+type Kind string
+
+const (
+	KindInternal Kind = "internal"
+	// KindServer is a span of an inbound request.
+	KindServer Kind = "server"
+	// KindClient is a span of an outbound request.
+	KindClient Kind = "client"
+)
+
+// SpanData is a finished span as it is exported.
+type SpanData struct {
+	Name       string                 `json:"name"`
+	Kind       Kind                   `json:"kind"`
+	Service    string                 `json:"service,omitempty"`
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// Span is an operation of a trace, it is exported once ended if it is sampled.
+type Span struct {
+	sc SpanContext
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+type contextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc, the spans started with it become its children.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, contextKey{}, sc)
+}
+
+// SpanContextFrom returns the span context of the current span of ctx, the zero one if it has none.
+func SpanContextFrom(ctx context.Context) SpanContext {
+	switch v := ctx.Value(contextKey{}).(type) {
+	case *Span:
+		return v.sc
+	case SpanContext:
+		return v
+	}
+	return SpanContext{}
+}
+
+// SpanFrom returns the current span of ctx, nil if it has none or it was started in another service.
+func SpanFrom(ctx context.Context) *Span {
+	s, _ := ctx.Value(contextKey{}).(*Span)
+	return s
+}
+
+// Start starts a span named name, the child of the current span of ctx, or a new trace if it has none.
+// The returned context carries the span.
+func Start(ctx context.Context, name string, kind Kind) (context.Context, *Span) {
+	parent := SpanContextFrom(ctx)
+	s := &Span{sc: SpanContext{SpanID: newSpanID(), Sampled: true}}
+	if parent.IsValid() {
+		s.sc.TraceID, s.sc.Sampled, s.sc.TraceState = parent.TraceID, parent.Sampled, parent.TraceState
+		s.data.ParentID = parent.SpanID.String()
+	} else {
+		s.sc.TraceID = newTraceID()
+	}
+	s.data.Name, s.data.Kind, s.data.Service = name, kind, serviceName()
+	s.data.TraceID, s.data.SpanID = s.sc.TraceID.String(), s.sc.SpanID.String()
+	s.data.Start = time.Now()
+	return context.WithValue(ctx, contextKey{}, s), s
+}
+
+// SpanContext returns the span context of s.
+func (s *Span) SpanContext() SpanContext {
+	return s.sc
+}
+
+// SetAttribute sets the attribute key of s to value.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+}
+
+// RecordError marks s as failed with err, nil is ignored.
+func (s *Span) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.ended {
+		s.data.Error = err.Error()
+	}
+}
+
+// End finishes s and exports it if sampled, only the first call counts.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		export(data)
+	}
+}
+
+func newTraceID() (id TraceID) {
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() (id SpanID) {
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
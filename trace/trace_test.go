@@ -0,0 +1,195 @@
+/*
+Copyright 2022 The Inspur AIStation Group Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Note: the example only works with the code within the same release/branch.
+
+package trace
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		wantErr     bool
+		wantSampled bool
+	}{
+		{"Sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, true},
+		{"NotSampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", false, false},
+		{"FutureVersion", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-comes", false, true},
+		{"TrailingDataOfVersion00", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-x", true, false},
+		{"InvalidVersion", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, false},
+		{"ZeroTraceID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", true, false},
+		{"ZeroSpanID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", true, false},
+		{"Uppercase", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", true, false},
+		{"Short", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.header)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTraceparent() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || sc.Sampled != tt.wantSampled {
+				t.Errorf("ParseTraceparent() = %+v", sc)
+			}
+			if tt.header[:2] == "00" && FormatTraceparent(sc) != tt.header {
+				t.Errorf("FormatTraceparent() = %v, want %v", FormatTraceparent(sc), tt.header)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      map[string]string
+		wantTraceID string
+		wantSampled bool
+	}{
+		{"Traceparent", map[string]string{TraceparentHeader: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", B3Header: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1"}, "4bf92f3577b34da6a3ce929d0e0e4736", true},
+		{"B3Single", map[string]string{B3Header: "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-0"}, "80f198ee56343ba864fe8b2a57d3eff7", false},
+		{"B3Multi64Bit", map[string]string{B3TraceIDHeader: "a3ce929d0e0e4736", B3SpanIDHeader: "e457b5a2e4d86bd1"}, "0000000000000000a3ce929d0e0e4736", true},
+		{"None", map[string]string{}, "", false},
+		{"Invalid", map[string]string{TraceparentHeader: "00-xyz"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.header {
+				h.Set(k, v)
+			}
+			sc := SpanContextFrom(Extract(context.Background(), h))
+			if tt.wantTraceID == "" {
+				if sc.IsValid() {
+					t.Errorf("Extract() = %+v, want none", sc)
+				}
+				return
+			}
+			if sc.TraceID.String() != tt.wantTraceID || sc.Sampled != tt.wantSampled || !sc.Remote {
+				t.Errorf("Extract() = %+v, want trace %v sampled %v", sc, tt.wantTraceID, tt.wantSampled)
+			}
+		})
+	}
+}
+
+func TestSpans(t *testing.T) {
+	exporter := NewMemoryExporter()
+	defer SetExporter(exporter)()
+
+	h := http.Header{}
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h.Set(TracestateHeader, "vendor=v1")
+	ctx, parent := Start(Extract(context.Background(), h), "parent", KindServer)
+	_, child := Start(ctx, "child", KindInternal)
+	child.SetAttribute("key", "value")
+	child.End()
+	child.End()
+	parent.End()
+
+	out := http.Header{}
+	Inject(ctx, out)
+	if got := out.Get(TraceparentHeader); got != FormatTraceparent(parent.SpanContext()) || out.Get(TracestateHeader) != "vendor=v1" {
+		t.Errorf("Inject() = %v, want the parent span with its tracestate", out)
+	}
+
+	spans := exporter.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want 2", len(spans))
+	}
+	if spans[0].Name != "child" || spans[0].ParentID != spans[1].SpanID || spans[0].Attributes["key"] != "value" {
+		t.Errorf("child span = %+v", spans[0])
+	}
+	if spans[1].ParentID != "00f067aa0ba902b7" || spans[1].TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("parent span = %+v", spans[1])
+	}
+
+	// not sampled by the caller.
+	exporter.Reset()
+	h.Set(TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := Start(Extract(context.Background(), h), "unsampled", KindServer)
+	span.End()
+	if spans := exporter.Spans(); len(spans) != 0 {
+		t.Errorf("exported %v, want no unsampled span", spans)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces", "traces.json")
+	e, err := NewFileExporter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer SetExporter(e)()
+	for _, name := range []string{"first", "second"} {
+		_, span := Start(context.Background(), name, KindInternal)
+		span.End()
+	}
+	e.Close()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var names []string
+	for s := bufio.NewScanner(f); s.Scan(); {
+		var span SpanData
+		if err := json.Unmarshal(s.Bytes(), &span); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, span.Name)
+	}
+	if len(names) != 2 || names[0] != "first" || names[1] != "second" {
+		t.Errorf("exported %v, want first and second", names)
+	}
+}
+
+func TestInitCloses(t *testing.T) {
+	defer viper.Reset()
+	dir := t.TempDir()
+	viper.Set("trace.exporter", "file")
+	viper.Set("trace.file", filepath.Join(dir, "first.json"))
+	Init()
+	first := exporter.(*FileExporter)
+
+	viper.Set("trace.file", filepath.Join(dir, "second.json"))
+	Init()
+	second := exporter.(*FileExporter)
+	if err := first.Export(SpanData{Name: "late"}); err == nil {
+		t.Errorf("Export() of the exporter replaced by Init error = nil, want it closed")
+	}
+
+	if err := Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := second.Export(SpanData{Name: "late"}); err == nil || exporter != nil {
+		t.Errorf("Export() after Close() error = %v, exporter = %v, want it closed and dropped", err, exporter)
+	}
+}